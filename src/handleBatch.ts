@@ -0,0 +1,101 @@
+import type { Context } from "elysia";
+import { buildTree } from "../utils/buildTree";
+import { describeError, errorResponse } from "../utils/errors";
+import { filterTree } from "../utils/filterTree";
+import { getIgnorePatterns } from "../utils/getIgnorePatterns";
+import { getTree } from "../utils/getTree";
+import { requestToken } from "../utils/github";
+import { mapLimit } from "../utils/mapLimit";
+import { parseOptions } from "../utils/parseOptions";
+import { parseRepoList } from "../utils/parseRepoList";
+import { DEFAULT_PROVIDER } from "../utils/providers";
+import { deadlineError, RetryBudget } from "../utils/retryBudget";
+import { withFinalNewline } from "../utils/withFinalNewline";
+
+// Repos of one batch fetched at a time
+const BATCH_CONCURRENCY = 5;
+
+type BatchResult =
+  | { branch: string; tree: string }
+  | { error: string; code: string };
+
+type BatchContext = {
+  body: unknown;
+  request: Request;
+  set: Context["set"];
+  retryBudget: RetryBudget;
+};
+
+// POST /batch with [{ owner, repo, branch?, provider? }]: the plain tree of
+// every repo, keyed by "[provider/]owner/repo[/branch]" as in the request
+// path. Query options apply to every tree. A repo that fails gets an error
+// entry instead of failing the whole batch. Every repo draws on the
+// request's retry budget and deadline.
+export async function handleBatch({
+  body,
+  request,
+  set,
+  retryBudget,
+}: BatchContext) {
+  try {
+    const targets = parseRepoList(body);
+    const options = parseOptions(new URL(request.url).searchParams);
+    const token = requestToken(request);
+
+    const results = await mapLimit(
+      targets,
+      BATCH_CONCURRENCY,
+      async (target): Promise<[string, BatchResult]> => {
+        const key = [
+          target.provider === DEFAULT_PROVIDER ? "" : target.provider,
+          target.owner,
+          target.repo,
+          target.branch,
+        ]
+          .filter(Boolean)
+          .join("/");
+        try {
+          const { owner, repo, branch, data } = await getTree(
+            target,
+            retryBudget,
+            token,
+            options.nocache
+          );
+          const ignored = options.ignoreFile
+            ? await getIgnorePatterns(
+                target.provider,
+                owner,
+                repo,
+                data.tree,
+                retryBudget,
+                token
+              )
+            : [];
+          // Unfiltered when the ignore file couldn't be fetched
+          const { tree, base } = filterTree(data.tree, options, ignored ?? []);
+          const context = {
+            provider: target.provider,
+            owner,
+            repo,
+            branch,
+            base,
+            truncated: data.truncated,
+            omitted: data.omitted,
+          };
+          const rendered = buildTree(tree, context, options);
+          return [key, { branch, tree: withFinalNewline(rendered, options) }];
+        } catch (err) {
+          const { message, code } = describeError(
+            deadlineError(retryBudget) ?? err
+          );
+          return [key, { error: message, code }];
+        }
+      }
+    );
+
+    return Object.fromEntries(results);
+  } catch (err) {
+    const { status, message, code } = describeError(err);
+    return errorResponse(request, set, status, message, code);
+  }
+}
@@ -0,0 +1,351 @@
+import type { Context } from "elysia";
+import { buildTree } from "../utils/buildTree";
+import { buildFileList } from "../utils/buildFileList";
+import { buildNestedTree } from "../utils/buildNestedTree";
+import { buildManifest } from "../utils/buildManifest";
+import { buildCsv } from "../utils/buildCsv";
+import { buildMarkdown } from "../utils/buildMarkdown";
+import { countEntries } from "../utils/countEntries";
+import { Options, parseOptions } from "../utils/parseOptions";
+import {
+  describeError,
+  errorResponse,
+  HttpError,
+  isUpstreamFailure,
+} from "../utils/errors";
+import { getActivity } from "../utils/getActivity";
+import { parseRepoPath, RepoPath } from "../utils/parseRepoPath";
+import { DEFAULT_PROVIDER } from "../utils/providers";
+import { validateRepoName } from "../utils/validateRepoName";
+import { getTree } from "../utils/getTree";
+import { filterTree } from "../utils/filterTree";
+import { getIgnorePatterns } from "../utils/getIgnorePatterns";
+import { paginate } from "../utils/paginate";
+import { recordRepoRequest } from "../utils/repoStats";
+import { getComparison } from "../utils/getComparison";
+import { renderComparison } from "../utils/renderComparison";
+import { deadlineError, RetryBudget } from "../utils/retryBudget";
+import { envNumber } from "../utils/envNumber";
+import { withFinalNewline } from "../utils/withFinalNewline";
+import { requestToken } from "../utils/github";
+
+// How a request fails when the tree isn't cached and GitHub can't be reached
+// (network error or 5xx). 4xx answers such as 404 are always passed through,
+// and a tree (or default branch) that expired in the last 24 hours is served
+// instead, with a Warning header, before any of these apply.
+// - error (default): 500 with the upstream error message
+// - unavailable: 503 with a Retry-After of FALLBACK_RETRY_AFTER seconds
+// - empty: 200 with an empty tree, flagged by a Warning header (and a
+//   "warning" field in JSON), never cached by clients
+const FALLBACK_BEHAVIOR = Bun.env.FALLBACK_BEHAVIOR || "error";
+if (!["error", "unavailable", "empty"].includes(FALLBACK_BEHAVIOR)) {
+  throw new Error(`Invalid FALLBACK_BEHAVIOR "${FALLBACK_BEHAVIOR}"`);
+}
+const FALLBACK_RETRY_AFTER = String(
+  envNumber("FALLBACK_RETRY_AFTER", 30, { integer: true })
+);
+
+// Weak validator for a rendering: the commit(s) it was built from plus the
+// query options, which together determine the output
+function etag(request: Request, ...shas: string[]): string {
+  const query = Bun.hash(new URL(request.url).search).toString(36);
+  return `W/"${shas.map((sha) => sha.slice(0, 12)).join("-")}-${query}"`;
+}
+
+// Whether the client's cached copy is still current: If-None-Match lists
+// tag (compared weakly), or when it isn't sent, If-Modified-Since is no
+// older than lastModified
+function notModified(
+  request: Request,
+  tag: string,
+  lastModified: Date | null
+): boolean {
+  const ifNoneMatch = request.headers.get("if-none-match");
+  if (ifNoneMatch !== null) {
+    const opaque = (value: string) => value.trim().replace(/^W\//, "");
+    if (ifNoneMatch.trim() === "*") return true;
+    const tags = ifNoneMatch.split(",").map(opaque);
+    return tags.includes(opaque(tag));
+  }
+  if (!lastModified) return false;
+  const since = Date.parse(request.headers.get("if-modified-since") ?? "");
+  // HTTP dates have whole seconds
+  return since >= Math.floor(lastModified.getTime() / 1000) * 1000;
+}
+
+// 304 with the headers set so far. Built directly, since a 304 can't have a
+// body (not even an empty one).
+function notModifiedResponse(set: Context["set"]): Response {
+  return new Response(null, {
+    status: 304,
+    headers: set.headers as Record<string, string>,
+  });
+}
+
+type HandlerContext = {
+  params: { "*": string };
+  request: Request;
+  set: Context["set"];
+  retryBudget: RetryBudget;
+};
+
+// GET|HEAD /[:provider/]:owner/:repo/:branch?  -> build tree
+export async function handleTree({
+  params,
+  request,
+  set,
+  retryBudget,
+}: HandlerContext) {
+  let parsed: RepoPath | null = null;
+  let options: Options | null = null;
+  try {
+    parsed = parseRepoPath(params["*"]);
+    if (!parsed) {
+      return errorResponse(
+        request,
+        set,
+        400,
+        "Invalid path, expected /owner/repo or /owner/repo/branch",
+        "invalid_path"
+      );
+    }
+
+    const nameError = validateRepoName(
+      parsed.provider,
+      parsed.owner,
+      parsed.repo
+    );
+    if (nameError) {
+      return errorResponse(request, set, 400, nameError, "invalid_repo_name");
+    }
+
+    options = parseOptions(new URL(request.url).searchParams);
+    const token = requestToken(request);
+
+    // Commit activity and comparisons use GitHub-only APIs
+    const usesGithubApis = Boolean(options.compare || options.activity);
+    if (usesGithubApis && parsed.provider !== DEFAULT_PROVIDER) {
+      throw new HttpError(
+        400,
+        "activity and base/head are only supported for GitHub repositories",
+        "unsupported_provider"
+      );
+    }
+
+    if (options.compare) {
+      const { owner, repo } = parsed;
+      const { base, head } = options.compare;
+      const { comparison, cacheHit } = await getComparison(
+        owner,
+        repo,
+        base,
+        head,
+        retryBudget,
+        token
+      );
+      set.headers["X-Cache"] = cacheHit ? "HIT" : "MISS";
+      set.headers["X-Commit-SHA"] = comparison.headSha;
+      const tag = etag(request, comparison.baseSha, comparison.headSha);
+      set.headers["ETag"] = tag;
+      if (notModified(request, tag, null)) return notModifiedResponse(set);
+      return withFinalNewline(
+        renderComparison(comparison, owner, repo, options),
+        options
+      );
+    }
+
+    const resolved = await getTree(
+      parsed,
+      retryBudget,
+      token,
+      options.nocache
+    );
+    const { owner, repo, branch, data, cacheHit, stale, maxAge } = resolved;
+    // Repos fetched with the caller's token may be private, and /stats
+    // can be public, so only shared fetches are counted
+    if (!token) {
+      recordRepoRequest(
+        parsed.provider === DEFAULT_PROVIDER
+          ? `${owner}/${repo}`
+          : `${parsed.provider}/${owner}/${repo}`
+      );
+    }
+    set.headers["X-Cache"] = cacheHit ? "HIT" : "MISS";
+    // Empty repos have no commit
+    if (data.sha) set.headers["X-Commit-SHA"] = data.sha;
+    if (!parsed.branch) set.headers["X-Default-Branch"] = branch;
+    const tag = etag(request, data.sha);
+    set.headers["ETag"] = tag;
+    if (`${owner}/${repo}` !== `${parsed.owner}/${parsed.repo}`) {
+      set.headers["X-Canonical-Repo"] = `${owner}/${repo}`;
+    }
+    // Every format, not just the plain tree, should say it's partial or
+    // out of date
+    const warnings: string[] = [];
+    if (stale) warnings.push('110 gtree "Response is Stale"');
+    if (data.truncated) {
+      warnings.push('199 gtree "tree truncated by the provider"');
+    } else if (data.omitted) {
+      warnings.push(`199 gtree "${data.omitted} entries omitted"`);
+    }
+    if (warnings.length > 0) set.headers["Warning"] = warnings.join(", ");
+
+    // Browsers and CDNs may reuse the response for as long as the tree stays
+    // cached. Trees fetched with the caller's token may be private, so
+    // shared caches must not keep them.
+    set.headers["Cache-Control"] = token
+      ? `private, max-age=${maxAge}`
+      : `public, max-age=${maxAge}, stale-while-revalidate=60`;
+    if (token) set.headers["Vary"] = "Authorization";
+
+    const lastModified = data.committedAt ? new Date(data.committedAt) : null;
+    if (lastModified) {
+      set.headers["Last-Modified"] = lastModified.toUTCString();
+    }
+    if (notModified(request, tag, lastModified)) {
+      return notModifiedResponse(set);
+    }
+
+    const ignored = options.ignoreFile
+      ? await getIgnorePatterns(
+          parsed.provider,
+          owner,
+          repo,
+          data.tree,
+          retryBudget,
+          token
+        )
+      : [];
+    if (ignored === null) {
+      warnings.push('199 gtree "ignore file unavailable, nothing hidden"');
+      set.headers["Warning"] = warnings.join(", ");
+      // Not the response the client asked for, so don't let it be reused
+      set.headers["Cache-Control"] = "no-store";
+    }
+    const filtered = filterTree(data.tree, options, ignored ?? []);
+    const { base } = filtered;
+    let tree = filtered.tree;
+
+    if (options.offset > 0 || options.limit > 0) {
+      const { page, total, nextOffset } = paginate(
+        tree,
+        options.offset,
+        options.limit,
+        options.sort
+      );
+      set.headers["X-Total-Entries"] = String(total);
+      if (nextOffset !== null) {
+        set.headers["X-Next-Offset"] = String(nextOffset);
+      }
+      // Past the end, so there is nothing left to show
+      if (options.offset > 0 && page.length === 0) return "";
+      tree = page;
+    }
+
+    const activity = options.activity
+      ? await getActivity(
+          owner,
+          repo,
+          branch,
+          base,
+          tree,
+          retryBudget,
+          token
+        )
+      : new Map<string, string>();
+    const annotations = new Map<string, string>();
+    activity.forEach((date, dir) => {
+      annotations.set(dir, `(last commit ${date})`);
+    });
+
+    if (options.format === "json") {
+      return {
+        repo: `${owner}/${repo}`,
+        branch,
+        sha: data.sha,
+        truncated: data.truncated,
+        omitted: data.omitted ?? 0,
+        root: base,
+        count: tree.length,
+        ...countEntries(tree),
+        options,
+        ...(options.activity && {
+          activity: Object.fromEntries(activity),
+        }),
+        tree: tree.map(({ path, type }) => ({ path, type })),
+        children: buildNestedTree(tree, options.sort),
+      };
+    }
+
+    const mime =
+      options.format === "csv"
+        ? "text/csv"
+        : options.format === "markdown"
+        ? "text/markdown"
+        : "text/plain";
+    const charset = options.charset === "ascii" ? "us-ascii" : "utf-8";
+    set.headers["Content-Type"] = `${mime}; charset=${charset}`;
+    const context = {
+      provider: parsed.provider,
+      owner,
+      repo,
+      branch,
+      base,
+      annotations,
+      truncated: data.truncated,
+      omitted: data.omitted,
+    };
+    if (options.format === "csv") {
+      return buildCsv(tree, options);
+    }
+    if (options.format === "files") {
+      return withFinalNewline(buildFileList(tree, context, options), options);
+    }
+    if (options.format === "manifest") {
+      return withFinalNewline(buildManifest(tree, options), options);
+    }
+    if (options.format === "markdown") {
+      return withFinalNewline(buildMarkdown(tree, context, options), options);
+    }
+    return withFinalNewline(buildTree(tree, context, options), options);
+  } catch (err) {
+    // Past the deadline, the error is whichever step got cut off first
+    const { status, message, code, retryAfter } = describeError(
+      deadlineError(retryBudget) ?? err
+    );
+    if (retryAfter) set.headers["Retry-After"] = String(retryAfter);
+
+    // Only the provider failing falls back, never our own bugs
+    const unavailable = isUpstreamFailure(err);
+    if (unavailable && FALLBACK_BEHAVIOR === "unavailable") {
+      set.headers["Retry-After"] = FALLBACK_RETRY_AFTER;
+      return errorResponse(request, set, 503, message, "upstream_unavailable");
+    }
+    if (unavailable && FALLBACK_BEHAVIOR === "empty" && parsed && options) {
+      const warning = "upstream unavailable, showing an empty tree";
+      set.headers["Warning"] = `199 gtree "${warning}"`;
+      set.headers["Cache-Control"] = "no-store";
+      const { owner, repo } = parsed;
+      const branch = parsed.branch ?? "HEAD";
+      if (options.format === "json") {
+        return {
+          repo: `${owner}/${repo}`,
+          branch,
+          warning,
+          count: 0,
+          directories: 0,
+          files: 0,
+          tree: [],
+          children: [],
+        };
+      }
+      if (options.format !== "plain") return "";
+      return withFinalNewline(
+        buildTree([], { owner, repo, branch, base: "" }, options),
+        options
+      );
+    }
+
+    return errorResponse(request, set, status, message, code);
+  }
+}
@@ -1,8 +1,24 @@
 import { Elysia } from "elysia";
+import type { Context } from "elysia";
 import { logger } from "@tqman/nice-logger";
-import { fetchDefaultBranch } from "../utils/fetchDefaultBranch";
-import { fetchRepoTree } from "../utils/fetchRepoTree";
-import { buildTree } from "../utils/buildTree";
+import { createRetryBudget } from "../utils/retryBudget";
+import { serializeResponse } from "../utils/serializeResponse";
+import {
+  cacheScope,
+  cacheStats,
+  inspectRepo,
+  invalidateRepo,
+} from "../utils/cache";
+import { isAdmin } from "../utils/isAdmin";
+import { parseRepoList } from "../utils/parseRepoList";
+import { getWarmJob, startWarmJob } from "../utils/warmJobs";
+import { describeError, errorResponse } from "../utils/errors";
+import { checkHealth } from "../utils/checkHealth";
+import { renderMetrics } from "../utils/metrics";
+import { topRepos } from "../utils/repoStats";
+import { DEFAULT_PROVIDER, providers } from "../utils/providers";
+import { handleTree } from "./handleTree";
+import { handleBatch } from "./handleBatch";
 
 // Token Bucket rate limiter (burst + smooth refill) per IP
 // Config: capacity (max burst), refillRate (tokens added per second)
@@ -31,28 +47,38 @@ function takeToken(ip: string): { allowed: boolean; remaining: number } {
   return { allowed: false, remaining: Math.floor(b.tokens) };
 }
 
-const port = Bun.env.PORT;
-if (!port) throw new Error("No port");
-
-// In-memory cache for repo trees (owner:repo:branch) -> tree string
-// 60 second TTL per key
-type CacheEntry = { value: string; expires: number };
-const TREE_CACHE_TTL_MS = 60_000;
-const treeCache = new Map<string, CacheEntry>();
-
-function getCache(key: string): string | null {
-  const entry = treeCache.get(key);
-  if (!entry) return null;
-  if (Date.now() > entry.expires) {
-    treeCache.delete(key);
-    return null;
-  }
-  return entry.value;
+// Provider the admin cache routes act on, from ?provider= (GitHub when
+// unset), or null when it isn't a known one
+function adminProvider(query: Record<string, string | undefined>) {
+  const provider = query.provider || DEFAULT_PROVIDER;
+  return provider in providers ? provider : null;
 }
 
-function setCache(key: string, value: string) {
-  treeCache.set(key, { value, expires: Date.now() + TREE_CACHE_TTL_MS });
-}
+const unknownProvider = (request: Request, set: Context["set"]) =>
+  errorResponse(request, set, 400, "unknown provider", "invalid_option");
+
+// Repos listed by GET /stats
+const STATS_TOP_REPOS = 10;
+
+// Origin browsers may call the service from ("*" for any)
+const CORS_ALLOW_ORIGIN = Bun.env.CORS_ALLOW_ORIGIN || "*";
+// Response headers scripts on that origin are allowed to read
+const CORS_EXPOSE_HEADERS = [
+  "ETag",
+  "Retry-After",
+  "X-Cache",
+  "X-Canonical-Repo",
+  "X-Commit-SHA",
+  "X-Default-Branch",
+  "X-Next-Offset",
+  "X-RateLimit-Limit",
+  "X-RateLimit-Remaining",
+  "X-RateLimit-Reset",
+  "X-Total-Entries",
+].join(", ");
+
+const port = Bun.env.PORT;
+if (!port) throw new Error("No port");
 
 const app = new Elysia()
   // Nice logger plugin (before other hooks so everything downstream is logged)
@@ -62,8 +88,15 @@ const app = new Elysia()
       withTimestamp: true,
     })
   )
+  // CORS headers on every response, including rate-limited ones
+  .onRequest(({ set }) => {
+    set.headers["Access-Control-Allow-Origin"] = CORS_ALLOW_ORIGIN;
+    set.headers["Access-Control-Expose-Headers"] = CORS_EXPOSE_HEADERS;
+  })
   // Rate limit hook (runs early)
   .onRequest(({ request, set }) => {
+    // Load balancer probes must never be throttled
+    if (new URL(request.url).pathname === "/healthz") return;
     const ipHeader =
       request.headers.get("x-forwarded-for") ||
       request.headers.get("x-real-ip") ||
@@ -78,10 +111,21 @@ const app = new Elysia()
     const secondsUntilFull = (RATE_CAPACITY - bucket.tokens) / REFILL_RATE;
     set.headers["X-RateLimit-Reset"] = `${Math.ceil(secondsUntilFull)}`;
     if (!allowed) {
-      set.status = 429;
-      return "Too many requests, we are detecting abuse.";
+      return errorResponse(
+        request,
+        set,
+        429,
+        "Too many requests, we are detecting abuse.",
+        "rate_limited"
+      );
     }
   })
+  // Fresh retry budget per request, shared by every GitHub call it makes
+  .derive(({ request }) => ({
+    retryBudget: createRetryBudget(request.signal),
+  }))
+  // Text/JSON serialization, HEAD bodies and gzip
+  .use(serializeResponse)
   // Root explanation route
   .get("/", () => {
     const explanation = `
@@ -94,11 +138,128 @@ in a tree-like format, similar to the Linux 'tree' command.
 Usage:
 GET /:owner/:repo
 GET /:owner/:repo/:branch
+GET /:provider/:owner/:repo/:branch?
+
+A .git suffix on the repo, as in clone URLs (/owner/repo.git), is ignored.
+
+HEAD works on the same paths and returns only the headers, including ETag
+and X-Commit-SHA, for cheap freshness checks. X-Cache (HIT or MISS) tells
+whether the tree came from the cache, and requests without a branch get
+the resolved one in X-Default-Branch. Last-Modified is the date of the
+commit the tree was listed at. Conditional requests get a 304 when the
+response hasn't changed, by If-None-Match (the ETag) or otherwise by
+If-Modified-Since. Cache-Control's max-age is how much longer the tree
+stays cached.
+
+Repositories too large for GitHub to list in one response come back
+truncated. The plain tree ends with a note saying so, JSON has
+"truncated": true and every format gets a Warning header. Trees are also
+capped at MAX_TREE_NODES entries (50000 by default); the rest are counted
+in the same kind of note and "omitted" in JSON.
 
 Parameters:
+- provider: Git hosting provider, github (default) or gitlab. Only
+  recognised when followed by both owner and repo, so /github/docs still
+  means the github/docs repository. GitLab uses gitlab.com unless the
+  deployment sets GITLAB_URL, and GITLAB_TOKEN (or your own token) for
+  private projects. activity and base/head are GitHub-only.
 - owner: GitHub username or organization name (required)
 - repo: Repository name (required)
-- branch: Branch name (optional, defaults to the repository's default branch)
+- branch: Branch name, tag or commit SHA (optional, defaults to the
+  repository's default branch), may contain slashes like feature/login.
+  Unknown refs of an existing repository give a 404 "ref not found".
+
+Query options:
+- format=json: return a JSON envelope with the resolved repo, branch, commit
+  sha, truncation flag, entry count, "directories" and "files" counts and
+  applied options alongside the tree, both as a flat "tree" list and as
+  nested "children" ({ name, path, type, children } with children only on
+  directories). format=plain (the default) is the text tree, ending with a
+  "N directories, M files" summary
+- format=files: flat, sorted list of file paths (no directories), one per line
+- format=manifest: "<sha><TAB><path>" for every file, sorted by path. The sha
+  is git's blob id (what \`git hash-object <file>\` prints), not a SHA-256
+  of the contents, so a checkout can be verified against it with git.
+- format=csv: "path,type,size,sha" rows (with a header row) as RFC 4180 CSV,
+  quoting paths that contain commas, quotes or line breaks
+- format=markdown: nested Markdown list for docs and issues, with names
+  escaped so they can't break the formatting. Add collapsible=true to wrap
+  each directory in a <details> block that GitHub renders collapsed
+- rawUrls=true: append each file's raw.githubusercontent.com URL. With
+  format=files the URL follows the path after a tab, giving a download
+  manifest.
+- charset=ascii: transliterate or \\u-escape non-ASCII characters in names and
+  serve the output as us-ascii (default: utf-8)
+- sizes=true: show each file's size (e.g. "(1.2 KB)") and each
+  directory's total in the tree
+- icons=true: prefix each entry in the tree with an emoji for its type
+  (a folder for directories, per-extension icons for files). Ignored with
+  charset=ascii
+- indent=ascii: draw the tree with |-- and \`-- instead of box-drawing
+  characters (default: unicode). Combine with charset=ascii for 7-bit output.
+- indent=spaces: indent each level by exactly indentSize spaces (1-8,
+  default 4) with no drawing characters, for editors that fold on indentation
+- path=<dir>: root the output at a subdirectory, e.g. path=src/components.
+  404 when the repo has no such directory
+- sourceRoot=auto: root the output at the repo's conventional source
+  directory. Candidates are checked in priority order (src, lib, app by
+  default, configurable with SOURCE_ROOTS) and the first that exists wins,
+  so a repo with both src/ and lib/ is rooted at src/. Falls back to the
+  repo root when none exist.
+- include=<glob>: only show paths matching the glob, plus their parent
+  directories. Repeat the parameter for several globs. Globs match the whole
+  path relative to the rendered root and support * and ? (within one path
+  segment), [abc] / [!abc] classes, ** (any number of directories) and
+  {a,b} alternatives, e.g. include={*.go,cmd/**/*.go}
+- ignorefile=false: show everything. By default entries matched by the
+  repo's root .gtreeignore (or, without one, its .gitignore) are hidden,
+  using the same rules as exclude. format=manifest and format=csv list
+  every committed file unless ignorefile=true is given. When the ignore
+  file can't be fetched, the tree is shown unfiltered with a Warning.
+- exclude=<pattern>: hide matching paths and everything below them, with
+  .gitignore semantics: "node_modules" and "*.lock" match at any depth,
+  "/build" or "docs/*.md" (containing a slash) are anchored to the root and
+  "dist/" only matches directories. Repeat the parameter or separate
+  patterns with commas, e.g. exclude=node_modules,dist/,*.lock. A leading
+  "!" re-includes what an earlier pattern excluded, except inside an
+  excluded directory. Exclusions win over include.
+- type=dir|file: only show directories, or only files (still under their
+  directories in the tree)
+- minSize=<bytes>: only show files of at least that size, plus their parent
+  directories (or just the files with format=files). Handy for finding what
+  bloats a repo; nothing matching gives an empty tree, not an error.
+- sort=dirs-first|name|name-desc|none: order of entries within each
+  directory. dirs-first (default) lists subdirectories before files, each
+  by name case-insensitively; name and name-desc ignore the type; none
+  keeps GitHub's order
+- depth=N: only show entries at most N levels below the root (depth=1 is
+  just the top level), like tree -L
+- offset=N, limit=M: page through large trees. Skips the first N entries
+  (counted in the order they're shown, after filtering) and shows at most M
+  of them (all when M is 0), with their parent directories for context. X-Total-Entries has
+  the number of entries, and X-Next-Offset the offset of the next page
+  unless this is the last. Past the end the body is empty.
+- maxChildren=N: show at most N entries per directory, ending each cut
+  directory with "... and M more", so a few huge directories can't drown
+  the rest of the tree
+- nocache=true: skip the cached tree and fetch it from GitHub again (the
+  result replaces the cached one). Concurrent requests for the same tree
+  still share a single fetch.
+- finalNewline=false: leave out the trailing newline that text output ends
+  with by default
+- activity=true: annotate each top-level directory with the date of its
+  latest commit. Only the first level is covered since every directory
+  costs a GitHub API call; results are cached and at most 50 directories
+  are looked up.
+
+Comparing refs:
+- base=<ref>&head=<ref>: instead of a full tree, show the files changed
+  between two refs (branches, tags or SHAs) with their status (added,
+  modified, removed, renamed, ...). Works with format=json, format=files
+  and include. GitHub lists at most 300 changed files per comparison.
+
+Unknown query parameters are ignored unless the deployment runs with
+QUERY_PARAMS_MODE=strict, in which case they are rejected with a 400.
 
 Examples:
 - /henilmalaviya/gtree         # Shows the default branch tree for henilmalaviya/gtree
@@ -114,47 +275,179 @@ The output format mimics the Linux 'tree' command, making it easy to visualize t
 file hierarchy. This service fetches data directly from the GitHub API and generates the tree view
 on-demand.
 
-Note: This service only works with public repositories due to GitHub API restrictions.
+Batch:
+- POST /batch with [{ owner, repo, branch?, provider? }] (at most 100):
+  a JSON object mapping each "owner/repo[/branch]" to { branch, tree } with
+  the plain tree, or { error, code } when that repo failed. Query options
+  apply to every tree, except offset and limit, which are ignored. The
+  whole batch shares one REQUEST_TIMEOUT_SECONDS deadline; repos not done
+  by then get a request_timeout error.
+
+Errors: plain text, or {"error":"...","code":"..."} when the request sends
+"Accept: application/json". Codes are stable: invalid_path,
+invalid_repo_name, invalid_option, unknown_parameter, invalid_body,
+unsupported_provider, repo_not_found, ref_not_found, path_not_found,
+repo_unavailable, rate_limited, upstream_rate_limited, upstream_error,
+upstream_unavailable, request_timeout (504, the request ran past
+REQUEST_TIMEOUT_SECONDS), internal_error (plus unauthorized, not_cached and
+job_not_found for /stats and admin endpoints).
+
+Health check:
+- GET /healthz: {"cache":"ok","github":"ok"} with 200 when GitHub is
+  reachable, 503 with the error otherwise. Not rate limited.
+
+Metrics:
+- GET /metrics: Prometheus metrics for cache hits/misses (branch and tree
+  lookups), API calls per provider and status, and API call latency
+
+Stats:
+- GET /stats: number of cached entries and trees, and the 10 most requested
+  repos since startup (requests made with the caller's own token aren't
+  counted). Requires "Authorization: Bearer <ADMIN_TOKEN>" when
+  the deployment sets ADMIN_TOKEN.
+
+Admin endpoints (require "Authorization: Bearer <ADMIN_TOKEN>"):
+- GET /admin/cache/:owner/:repo: cached keys for a repo with TTLs and sizes
+- DELETE /admin/cache/:owner/:repo: drop the repo's cached default branch,
+  trees (including the stale copies), rename alias, activity and
+  comparisons; returns how many keys were deleted (404 when nothing was
+  cached)
+- Both take ?provider=gitlab for GitLab repos (github by default), and only
+  cover shared entries, not ones fetched with a caller's own token
+- POST /warm: fetch and cache [{ owner, repo, branch?, provider? }] in the
+  background; poll GET /admin/warm/:id for per-repo results
+
+Private repositories: send your own GitHub token as "Authorization: token
+<token>" (or ?token=<token>, which may end up in access logs); "Bearer"
+credentials are never sent to the provider. Results are cached per token
+and marked private so they're never served to anyone else.
     `.trim();
     return explanation;
   })
-  // GET /:owner/:repo/:branch?  -> build tree
-  .get("/:owner/:repo/:branch?", async ({ params, set }) => {
-    try {
-      const { owner, repo } = params as { owner: string; repo: string };
-      let branch = (params as { branch?: string }).branch;
-
-      if (!owner || !repo) {
-        set.status = 400;
-        return "owner and repo are required";
-      }
-
-      if (!branch) {
-        branch = await fetchDefaultBranch(owner, repo);
-      }
-
-      const cacheKey = `${owner}:${repo}:${branch}`;
-      const cached = getCache(cacheKey);
-      if (cached) {
-        set.headers["X-Cache"] = "HIT";
-        set.headers["Cache-Control"] =
-          "s-maxage=600, stale-while-revalidate=60";
-        return cached;
-      }
-
-      const { tree } = await fetchRepoTree(owner, repo, branch!);
-      const treeString = buildTree(tree, owner, repo, branch!);
-      setCache(cacheKey, treeString);
-      set.headers["X-Cache"] = "MISS";
-
-      // Set caching headers (similar to Hono / Vercel Edge example)
-      set.headers["Cache-Control"] = "s-maxage=600, stale-while-revalidate=60";
-      return treeString;
-    } catch (err: any) {
-      set.status = 500;
-      return `Error: ${err?.message || "unknown"}`;
+  // Liveness/readiness probe: 200 when GitHub is reachable, 503 otherwise
+  .get("/healthz", async ({ set }) => {
+    const { healthy, checks } = await checkHealth();
+    set.status = healthy ? 200 : 503;
+    set.headers["Cache-Control"] = "no-store";
+    return checks;
+  })
+  // Prometheus scrape target
+  .get("/metrics", ({ set }) => {
+    set.headers["Content-Type"] = "text/plain; version=0.0.4; charset=utf-8";
+    return renderMetrics();
+  })
+  // What's cached and which repos are asked for most. Public unless
+  // ADMIN_TOKEN is set.
+  .get("/stats", ({ request, set }) => {
+    if (Bun.env.ADMIN_TOKEN && !isAdmin(request)) {
+      return errorResponse(request, set, 401, "Unauthorized", "unauthorized");
     }
+    set.headers["Cache-Control"] = "no-store";
+    return { cache: cacheStats(), topRepos: topRepos(STATS_TOP_REPOS) };
+  })
+  // Admin routes, gated behind ADMIN_TOKEN
+  .guard(
+    {
+      beforeHandle({ request, set }) {
+        if (!isAdmin(request)) {
+          return errorResponse(
+            request,
+            set,
+            401,
+            "Unauthorized",
+            "unauthorized"
+          );
+        }
+      },
+    },
+    (admin) =>
+      admin
+        // Cached keys for a repo with their remaining TTL and size
+        .get("/admin/cache/:owner/:repo", ({ params, query, request, set }) => {
+          const { owner, repo } = params;
+          const provider = adminProvider(query);
+          if (!provider) return unknownProvider(request, set);
+          const scope = cacheScope(provider);
+          const branchKey = `${scope}default_branch:${owner}:${repo}`;
+          const entries = inspectRepo(provider, owner, repo);
+          const branchEntry = entries.find((entry) => entry.key === branchKey);
+          return {
+            defaultBranch: branchEntry
+              ? { exists: true, ...branchEntry }
+              : { exists: false, key: branchKey },
+            trees: entries.filter((entry) =>
+              entry.key.startsWith(`${scope}tree:`)
+            ),
+            entries,
+          };
+        })
+        // Drop a repo's cached entries, e.g. from a push webhook
+        .delete(
+          "/admin/cache/:owner/:repo",
+          ({ params, query, request, set }) => {
+            const provider = adminProvider(query);
+            if (!provider) return unknownProvider(request, set);
+            const keys = invalidateRepo(provider, params.owner, params.repo);
+            if (keys.length === 0) {
+              return errorResponse(
+                request,
+                set,
+                404,
+                "nothing cached for repo",
+                "not_cached"
+              );
+            }
+            return { deleted: keys.length, keys };
+          }
+        )
+        // Fetch and cache a list of repos in the background, e.g. after a
+        // deploy. Body: [{ owner, repo, branch?, provider? }]
+        .post("/warm", ({ body, request, set }) => {
+          try {
+            const job = startWarmJob(parseRepoList(body));
+            set.status = 202;
+            return {
+              id: job.id,
+              count: job.results.length,
+              status: `/admin/warm/${job.id}`,
+            };
+          } catch (err) {
+            const { status, message, code } = describeError(err);
+            return errorResponse(request, set, status, message, code);
+          }
+        })
+        // Per-repo progress and results of a warm job. Lives under /admin
+        // so it can't shadow a GitHub owner named "warm".
+        .get("/admin/warm/:id", ({ params, request, set }) => {
+          return (
+            getWarmJob(params.id) ??
+            errorResponse(
+              request,
+              set,
+              404,
+              "warm job not found",
+              "job_not_found"
+            )
+          );
+        })
+  )
+  // Several repos' trees in one round trip
+  .post("/batch", handleBatch)
+  // CORS preflight for any path, answered before the path is parsed
+  .options("/*", ({ set }) => {
+    set.headers["Access-Control-Allow-Methods"] =
+      "GET, HEAD, POST, DELETE, OPTIONS";
+    set.headers["Access-Control-Allow-Headers"] =
+      "Authorization, Content-Type, If-None-Match, If-Modified-Since";
+    set.headers["Access-Control-Max-Age"] = "86400";
+    return new Response(null, {
+      status: 204,
+      headers: set.headers as Record<string, string>,
+    });
   })
+  // GET|HEAD /[:provider/]:owner/:repo/:branch?  -> build tree
+  .get("/*", handleTree)
+  .head("/*", handleTree)
   .listen(port);
 
 console.log(
@@ -0,0 +1,12 @@
+// Whether an Accept-Encoding header allows gzip (explicitly or via "*"),
+// honouring q=0 as a refusal
+export function acceptsGzip(header: string | null): boolean {
+  if (!header) return false;
+
+  return header.split(",").some((part) => {
+    const [coding, ...params] = part.split(";").map((p) => p.trim());
+    if (coding !== "gzip" && coding !== "*") return false;
+    const q = params.find((p) => p.startsWith("q="));
+    return !q || Number(q.slice(2)) > 0;
+  });
+}
@@ -0,0 +1,24 @@
+import { TreeNode } from "./fetchRepoTree";
+import { Options } from "./parseOptions";
+import { toAscii } from "./toAscii";
+
+// RFC 4180: quote fields containing a comma, quote or line break, doubling
+// any quotes inside them
+function csvField(value: string): string {
+  return /[",\r\n]/.test(value) ? `"${value.replace(/"/g, '""')}"` : value;
+}
+
+// One "path,type,size,sha" row per entry after a header row, CRLF separated
+// as RFC 4180 specifies. Directories have an empty size.
+export function buildCsv(treeData: TreeNode[], options: Options): string {
+  const rows = [
+    ["path", "type", "size", "sha"],
+    ...treeData.map((item) => [
+      options.charset === "ascii" ? toAscii(item.path) : item.path,
+      item.type,
+      item.size === undefined ? "" : `${item.size}`,
+      item.sha,
+    ]),
+  ];
+  return rows.map((row) => row.map(csvField).join(",")).join("\r\n") + "\r\n";
+}
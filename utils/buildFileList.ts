@@ -0,0 +1,28 @@
+import { TreeContext } from "./buildTree";
+import { TreeNode } from "./fetchRepoTree";
+import { Options } from "./parseOptions";
+import { DEFAULT_PROVIDER, providers } from "./providers";
+import { toAscii } from "./toAscii";
+
+// Flat list of file paths (relative to the rendered root), one per line.
+// With rawUrls each path is followed by a tab and its raw download URL.
+export function buildFileList(
+  treeData: TreeNode[],
+  context: TreeContext,
+  options: Options
+): string {
+  const { owner, repo, branch, base } = context;
+  const { rawUrl } = providers[context.provider ?? DEFAULT_PROVIDER];
+
+  return treeData
+    .filter((item) => item.type === "blob")
+    .map((item) => {
+      const path =
+        options.charset === "ascii" ? toAscii(item.path) : item.path;
+      if (!options.rawUrls) return path;
+      const fullPath = base ? `${base}/${item.path}` : item.path;
+      return `${path}\t${rawUrl(owner, repo, branch, fullPath)}`;
+    })
+    .sort()
+    .join("\n");
+}
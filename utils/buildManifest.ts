@@ -0,0 +1,17 @@
+import { TreeNode } from "./fetchRepoTree";
+import { Options } from "./parseOptions";
+import { toAscii } from "./toAscii";
+
+// "<sha>\t<path>" for every file, sorted by path. The sha is git's blob id
+// (SHA-1 of "blob <size>\0<content>", as printed by `git hash-object`), not a
+// SHA-256 of the file contents.
+export function buildManifest(treeData: TreeNode[], options: Options): string {
+  return treeData
+    .filter((item) => item.type === "blob")
+    .sort((a, b) => (a.path < b.path ? -1 : a.path > b.path ? 1 : 0))
+    .map((item) => {
+      const path = options.charset === "ascii" ? toAscii(item.path) : item.path;
+      return `${item.sha}\t${path}`;
+    })
+    .join("\n");
+}
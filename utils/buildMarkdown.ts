@@ -0,0 +1,69 @@
+import { TreeContext } from "./buildTree";
+import { countEntries } from "./countEntries";
+import { buildNestedTree, NestedNode } from "./buildNestedTree";
+import { escapeHtml } from "./errors";
+import { TreeNode } from "./fetchRepoTree";
+import { Options } from "./parseOptions";
+import { DEFAULT_PROVIDER, providers } from "./providers";
+import { toAscii } from "./toAscii";
+
+// Backslash-escape what Markdown could read as formatting, so names like
+// "_build", "[id].tsx" or "1. intro.md" render literally
+const escapeMarkdown = (value: string) =>
+  value
+    .replace(/[\\`*_[\]<>|~]/g, "\\$&")
+    .replace(/^[#+-]/, "\\$&")
+    .replace(/^(\d+)([.)])/, "$1\\$2");
+
+// The tree as a nested Markdown list under a bold root line. With
+// options.collapsible, every directory is a <details> block (collapsed by default on
+// GitHub) whose <summary> is the directory name.
+export function buildMarkdown(
+  treeData: TreeNode[],
+  context: TreeContext,
+  options: Options
+): string {
+  const { owner, repo, branch, base, annotations } = context;
+  const { rawUrl } = providers[context.provider ?? DEFAULT_PROVIDER];
+  const display = (name: string) =>
+    options.charset === "ascii" ? toAscii(name) : name;
+  const rootName = `${owner}/${repo}:${branch}${base ? `/${base}` : ""}`;
+  const lines = [`**${escapeMarkdown(display(rootName))}**`, ""];
+
+  function renderLevel(nodes: NestedNode[], indent: string): void {
+    nodes.forEach((node) => {
+      const note = annotations?.get(node.path);
+      const suffix = note ? ` ${escapeMarkdown(display(note))}` : "";
+
+      if (node.children) {
+        const name = `${display(node.name)}/`;
+        if (!options.collapsible) {
+          lines.push(`${indent}- **${escapeMarkdown(name)}**${suffix}`);
+          renderLevel(node.children, `${indent}  `);
+          return;
+        }
+        // GitHub only renders Markdown inside <details> between blank lines
+        lines.push(
+          `${indent}- <details><summary>${escapeHtml(name)}</summary>${suffix}`,
+          ""
+        );
+        renderLevel(node.children, `${indent}  `);
+        lines.push("", `${indent}  </details>`);
+        return;
+      }
+
+      const name = escapeMarkdown(display(node.name));
+      const fullPath = base ? `${base}/${node.path}` : node.path;
+      const entry = options.rawUrls
+        ? `[${name}](${rawUrl(owner, repo, branch, fullPath)})`
+        : name;
+      lines.push(`${indent}- ${entry}${suffix}`);
+    });
+  }
+
+  renderLevel(buildNestedTree(treeData, options.sort), "");
+
+  const { directories, files } = countEntries(treeData);
+  lines.push("", `${directories} directories, ${files} files`);
+  return lines.join("\n");
+}
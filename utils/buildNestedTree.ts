@@ -0,0 +1,62 @@
+import { TreeNode } from "./fetchRepoTree";
+import { SortOrder } from "./parseOptions";
+import { sortEntries } from "./sortEntries";
+
+export type NestedNode = {
+  name: string;
+  path: string;
+  type: string;
+  // Only present on directories
+  children?: NestedNode[];
+};
+
+// Nest the flat tree listing under its parent directories, sorted the same
+// way as the text tree at every level. Directories missing from the listing
+// (e.g. when a filter kept only their files) are created from the paths
+// beneath them.
+export function buildNestedTree(
+  treeData: TreeNode[],
+  order: SortOrder
+): NestedNode[] {
+  const root: NestedNode[] = [];
+  const dirs = new Map<string, NestedNode>();
+
+  const childrenOf = (path: string): NestedNode[] => {
+    if (!path) return root;
+    let dir = dirs.get(path);
+    if (!dir) {
+      const slash = path.lastIndexOf("/");
+      dir = {
+        name: path.slice(slash + 1),
+        path,
+        type: "tree",
+        children: [],
+      };
+      dirs.set(path, dir);
+      childrenOf(path.slice(0, Math.max(slash, 0))).push(dir);
+    }
+    return dir.children!;
+  };
+
+  treeData.forEach((item) => {
+    if (item.type === "tree") {
+      childrenOf(item.path);
+      return;
+    }
+    const slash = item.path.lastIndexOf("/");
+    childrenOf(item.path.slice(0, Math.max(slash, 0))).push({
+      name: item.path.slice(slash + 1),
+      path: item.path,
+      type: item.type,
+    });
+  });
+
+  const sort = (nodes: NestedNode[]): NestedNode[] =>
+    sortEntries(
+      nodes.map((node) => ({ ...node, isDir: node.type === "tree" })),
+      order
+    ).map(({ isDir, ...node }) =>
+      node.children ? { ...node, children: sort(node.children) } : node
+    );
+  return sort(root);
+}
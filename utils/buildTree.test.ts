@@ -0,0 +1,33 @@
+import { describe, expect, test } from "bun:test";
+import { buildTree } from "./buildTree";
+import { parseOptions } from "./parseOptions";
+
+describe("buildTree", () => {
+  const tree = [
+    { path: "src", type: "tree", sha: "1" },
+    { path: "src/index.ts", type: "blob", sha: "2" },
+    { path: "README.md", type: "blob", sha: "3" },
+  ];
+  const context = { owner: "owner", repo: "repo", branch: "main", base: "" };
+  const options = parseOptions(new URLSearchParams());
+
+  test("marks directories with a trailing slash, files without", () => {
+    const lines = buildTree(tree, context, options).split("\n");
+    expect(lines).toContain("├── src/");
+    expect(lines).toContain("│   └── index.ts");
+    expect(lines).toContain("└── README.md");
+  });
+
+  test("renders the whole tree", () => {
+    expect(buildTree(tree, context, options)).toBe(
+      [
+        "owner/repo:main",
+        "├── src/",
+        "│   └── index.ts",
+        "└── README.md",
+        "",
+        "1 directories, 2 files",
+      ].join("\n")
+    );
+  });
+});
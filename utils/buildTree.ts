@@ -1,13 +1,55 @@
 import { TreeNode } from "./fetchRepoTree";
+import { iconFor } from "./fileIcons";
+import { formatSize } from "./formatSize";
+import { IndentStyle, Options } from "./parseOptions";
+import { DEFAULT_PROVIDER, providers } from "./providers";
+import { sortEntries } from "./sortEntries";
+import { toAscii } from "./toAscii";
+
+type Connectors = { branch: string; last: string; pipe: string; blank: string };
+
+const CONNECTORS: Record<Exclude<IndentStyle, "spaces">, Connectors> = {
+  unicode: { branch: "├── ", last: "└── ", pipe: "│   ", blank: "    " },
+  ascii: { branch: "|-- ", last: "`-- ", pipe: "|   ", blank: "    " },
+};
+
+// "spaces" indents every level by exactly indentSize spaces with no drawing
+// characters, so editors can fold on indentation
+function connectorsFor(options: Options): Connectors {
+  if (options.indent !== "spaces") return CONNECTORS[options.indent];
+  const unit = " ".repeat(options.indentSize);
+  return { branch: unit, last: unit, pipe: unit, blank: unit };
+}
+
+export type TreeContext = {
+  // Where the repo is hosted, github when unset
+  provider?: string;
+  owner: string;
+  repo: string;
+  branch: string;
+  // Directory the tree was re-rooted at, "" for the repo root
+  base: string;
+  // Extra text shown after an entry, keyed by path relative to base
+  annotations?: Map<string, string>;
+  // The provider cut the listing short, so the tree is incomplete
+  truncated?: boolean;
+  // Entries left out for exceeding MAX_TREE_NODES
+  omitted?: number;
+};
 
 export function buildTree(
   treeData: TreeNode[],
-  owner: string,
-  repo: string,
-  branch: string
+  context: TreeContext,
+  options: Options
 ): string {
+  const { owner, repo, branch, base, annotations, truncated, omitted } =
+    context;
+  const { rawUrl } = providers[context.provider ?? DEFAULT_PROVIDER];
   const treeMap = new Map<string, { children: string[]; isDir: boolean }>();
-  const rootName = `${owner}/${repo}:${branch}`;
+  const rootName = `${owner}/${repo}:${branch}${base ? `/${base}` : ""}`;
+  const connectors = connectorsFor(options);
+  const display = (name: string) =>
+    options.charset === "ascii" ? toAscii(name) : name;
 
   treeMap.set(rootName, { children: [], isDir: true });
 
@@ -16,10 +58,7 @@ export function buildTree(
     let currentPath = rootName;
 
     parts.forEach((part, index) => {
-      const fullPath =
-        currentPath === rootName
-          ? `${currentPath}/${part}`
-          : `${currentPath}/${part}`;
+      const fullPath = `${currentPath}/${part}`;
 
       if (!treeMap.has(fullPath)) {
         treeMap.set(fullPath, {
@@ -36,7 +75,22 @@ export function buildTree(
     });
   });
 
-  let output = `${rootName}\n`;
+  // With sizes, files show their own size and directories the total of
+  // everything below them (blobs without a size, e.g. from GitLab, count 0)
+  const sizes = new Map<string, number>();
+  if (options.sizes) {
+    treeData.forEach((item) => {
+      if (item.size === undefined) return;
+      sizes.set(item.path, item.size);
+      let dir = item.path;
+      while (dir.includes("/")) {
+        dir = dir.slice(0, dir.lastIndexOf("/"));
+        sizes.set(dir, (sizes.get(dir) ?? 0) + item.size);
+      }
+    });
+  }
+
+  let output = `${display(rootName)}\n`;
   const processed = new Set<string>();
 
   function buildLevel(path: string, prefix: string = ""): void {
@@ -44,21 +98,48 @@ export function buildTree(
     processed.add(path);
 
     const entry = treeMap.get(path)!;
-    const children = entry.children.sort();
+    const sorted = sortEntries(
+      entry.children.map((name) => ({
+        name,
+        isDir: treeMap.get(`${path}/${name}`)!.isDir,
+      })),
+      options.sort
+    ).map((child) => child.name);
+    // With maxChildren, oversized directories are cut independently and end
+    // with a "... and N more" line
+    const children =
+      options.maxChildren > 0 ? sorted.slice(0, options.maxChildren) : sorted;
+    const hidden = sorted.length - children.length;
 
     children.forEach((child, index) => {
       const childPath = `${path}/${child}`;
       if (!treeMap.has(childPath)) return;
 
-      const isLast = index === children.length - 1;
-      const newPrefix = prefix + (isLast ? "    " : "│   ");
-      const connector = isLast ? "└── " : "├── ";
-
-      output += `${prefix}${connector}${child}${
-        treeMap.get(childPath)!.isDir ? "/" : ""
-      }\n`;
+      const isLast = index === children.length - 1 && hidden === 0;
+      const newPrefix = prefix + (isLast ? connectors.blank : connectors.pipe);
+      const connector = isLast ? connectors.last : connectors.branch;
+      const relativePath = childPath.slice(rootName.length + 1);
+      const isDir = treeMap.get(childPath)!.isDir;
+      const note = annotations?.get(relativePath);
+      const size = sizes.get(relativePath);
+      const fullPath = base ? `${base}/${relativePath}` : relativePath;
+      const url =
+        options.rawUrls && !isDir ? rawUrl(owner, repo, branch, fullPath) : "";
+      // Emoji can't be shown in 7-bit output, so charset=ascii drops them
+      const icon =
+        options.icons && options.charset !== "ascii"
+          ? `${iconFor(child, isDir)} `
+          : "";
+
+      output += `${prefix}${connector}${icon}${display(child)}${isDir ? "/" : ""}${
+        size === undefined ? "" : `  (${formatSize(size)})`
+      }${note ? `  ${display(note)}` : ""}${url ? `  ${url}` : ""}\n`;
       buildLevel(childPath, newPrefix);
     });
+
+    if (hidden > 0) {
+      output += `${prefix}${connectors.last}... and ${hidden} more\n`;
+    }
   }
 
   buildLevel(rootName);
@@ -69,6 +150,12 @@ export function buildTree(
     (item) => !item.isDir
   ).length;
   output += `\n${dirs} directories, ${files} files`;
+  if (truncated) {
+    output += "\n... (tree truncated upstream, the listing is incomplete)";
+  }
+  if (omitted) {
+    output += `\n... (${omitted} more entries not shown, repo exceeds limit)`;
+  }
 
   return output;
 }
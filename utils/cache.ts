@@ -0,0 +1,156 @@
+// In-memory TTL cache shared by the route handlers
+// Keys are namespaced by what they hold:
+//   default_branch:owner:repo -> resolved default branch name
+//   tree:owner:repo:branch    -> GitHub trees response
+//   stale:tree:owner:repo:branch -> the same, kept longer for revalidation
+//   alias:owner:repo          -> owner/repo it was renamed to
+// (see isRepoKey for the rest)
+// Entries fetched with a caller's own token go under token:<hash>: (see
+// tokenScope) so they're never served to other callers, and entries of
+// providers other than GitHub under <provider>: (see cacheScope).
+// Branch names may contain "/" but never ":" (git forbids it in ref names),
+// so keys for different repos and branches can't collide.
+import { parseDuration } from "./parseDuration";
+import { DEFAULT_PROVIDER } from "./providers";
+
+type CacheEntry = { value: unknown; expires: number };
+
+// Default lifetime of cached entries. CACHE_TTL takes a duration ("30s",
+// "10m", "2h", "1h30m", see parseDuration) or, as before units were
+// supported, a bare number of minutes ("5", "1.5"). Defaults to one minute.
+function cacheTtl(): number {
+  const value = Bun.env.CACHE_TTL?.trim();
+  if (!value) return 60_000;
+  const ttlMs = parseDuration(value, "m");
+  if (ttlMs === null) throw new Error(`Invalid CACHE_TTL "${value}"`);
+  return ttlMs;
+}
+
+export const CACHE_TTL_MS = cacheTtl();
+// Every TTL is randomly stretched or shrunk by up to this fraction, so
+// entries written together (e.g. popular repos after a restart) don't all
+// expire at once
+const TTL_JITTER = 0.1;
+const cache = new Map<string, CacheEntry>();
+
+export function getCache<T>(key: string): T | null {
+  const entry = cache.get(key);
+  if (!entry) return null;
+  if (Date.now() > entry.expires) {
+    cache.delete(key);
+    return null;
+  }
+  return entry.value as T;
+}
+
+// Key prefix for results fetched with token, which may include private
+// repos. Shared results (no token) keep the unprefixed keys.
+export function tokenScope(token?: string): string {
+  if (!token) return "";
+  const hash = new Bun.CryptoHasher("sha256").update(token).digest("hex");
+  return `token:${hash.slice(0, 16)}:`;
+}
+
+// Key prefix for entries of provider, fetched with token if any. GitHub
+// keeps unprefixed keys, so a GitLab owner/repo can't collide with the
+// GitHub repo of the same name.
+export function cacheScope(provider: string, token?: string): string {
+  const providerScope = provider === DEFAULT_PROVIDER ? "" : `${provider}:`;
+  return `${tokenScope(token)}${providerScope}`;
+}
+
+export function setCache(key: string, value: unknown, ttlMs = CACHE_TTL_MS) {
+  const jitter = 1 + (Math.random() * 2 - 1) * TTL_JITTER;
+  cache.set(key, { value, expires: Date.now() + Math.round(ttlMs * jitter) });
+}
+
+// Seconds until the entry under key expires, 0 when it isn't cached
+export function cacheExpiresIn(key: string): number {
+  const entry = cache.get(key);
+  if (!entry) return 0;
+  return Math.max(0, Math.ceil((entry.expires - Date.now()) / 1000));
+}
+
+// Namespaces with a single entry per repo (namespace:owner:repo), and ones
+// with several (namespace:owner:repo:...)
+const REPO_NAMESPACES = ["default_branch", "stale:default_branch", "alias"];
+const REPO_PREFIX_NAMESPACES = [
+  "tree",
+  "stale:tree",
+  "activity",
+  "compare",
+  "ref",
+];
+
+// Whether key holds one of the shared (not per-token) entries of
+// owner/repo on provider
+function isRepoKey(
+  key: string,
+  provider: string,
+  owner: string,
+  repo: string
+): boolean {
+  const scope = cacheScope(provider);
+  const id = `${owner}:${repo}`;
+  return (
+    REPO_NAMESPACES.some((ns) => key === `${scope}${ns}:${id}`) ||
+    REPO_PREFIX_NAMESPACES.some((ns) =>
+      key.startsWith(`${scope}${ns}:${id}:`)
+    )
+  );
+}
+
+// Remove the shared (not per-token) entries of owner/repo on provider: its
+// default branch, trees (and their stale copies), rename alias, activity,
+// comparisons and the refs they were resolved from. Returns the keys of the
+// live entries that were removed.
+export function invalidateRepo(
+  provider: string,
+  owner: string,
+  repo: string
+): string[] {
+  const now = Date.now();
+  const deleted: string[] = [];
+
+  cache.forEach((entry, key) => {
+    if (!isRepoKey(key, provider, owner, repo)) return;
+    cache.delete(key);
+    if (now <= entry.expires) deleted.push(key);
+  });
+
+  return deleted;
+}
+
+// Number of live entries, and how many of them are trees (in any scope,
+// not counting the stale copies kept for revalidation)
+export function cacheStats() {
+  const now = Date.now();
+  let entries = 0;
+  let trees = 0;
+
+  cache.forEach((entry, key) => {
+    if (now > entry.expires) return;
+    entries += 1;
+    if (/(^|:)tree:/.test(key) && !key.includes("stale:tree:")) trees += 1;
+  });
+
+  return { entries, trees };
+}
+
+// Remaining TTL (seconds) and serialized size (bytes) of every live shared
+// entry of owner/repo on provider, without returning the values themselves
+export function inspectRepo(provider: string, owner: string, repo: string) {
+  const now = Date.now();
+  const entries: { key: string; ttl: number; size: number }[] = [];
+
+  cache.forEach((entry, key) => {
+    if (!isRepoKey(key, provider, owner, repo) || now > entry.expires) return;
+    entries.push({
+      key,
+      ttl: Math.ceil((entry.expires - now) / 1000),
+      size: Buffer.byteLength(JSON.stringify(entry.value)),
+    });
+  });
+
+  return entries;
+}
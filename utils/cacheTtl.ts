@@ -0,0 +1,47 @@
+import { readFileSync } from "fs";
+import { CACHE_TTL_MS } from "./cache";
+import { compileGlobs } from "./glob";
+import { parseDuration } from "./parseDuration";
+
+type TtlRule = { matches: (target: string) => boolean; ttlMs: number };
+
+// CACHE_TTL_RULES overrides how long trees stay cached for matching repos.
+// It holds a JSON array, inline or as a path to a JSON file, of
+// { "match": pattern, "ttl": duration } rules, e.g.
+//   [{ "match": "torvalds/linux", "ttl": "5m" },
+//    { "match": "gitlab:mirrors/*", "ttl": "6h" }]
+// Patterns are globs over "owner/repo", optionally prefixed with
+// "provider:" to only apply to one provider. The first matching rule wins.
+// A ttl without a unit is in minutes, as in CACHE_TTL.
+function loadRules(): TtlRule[] {
+  const config = Bun.env.CACHE_TTL_RULES?.trim();
+  if (!config) return [];
+
+  const json = config.startsWith("[") ? config : readFileSync(config, "utf8");
+  const rules = JSON.parse(json);
+  if (!Array.isArray(rules)) {
+    throw new Error("CACHE_TTL_RULES must be a JSON array of rules");
+  }
+
+  return rules.map((rule, index) => {
+    const ttlMs = parseDuration(rule?.ttl ?? "", "m");
+    if (typeof rule?.match !== "string" || ttlMs === null) {
+      throw new Error(
+        `Invalid CACHE_TTL_RULES entry ${index}, expected { match, ttl }`
+      );
+    }
+    const pattern = rule.match.includes(":")
+      ? rule.match
+      : `*:${rule.match}`;
+    return { matches: compileGlobs([pattern]), ttlMs };
+  });
+}
+
+const TTL_RULES = loadRules();
+
+// TTL for a repo's cached tree: the first matching rule's, or the default
+export function treeTtl(provider: string, owner: string, repo: string) {
+  const target = `${provider}:${owner}/${repo}`;
+  const rule = TTL_RULES.find((rule) => rule.matches(target));
+  return rule ? rule.ttlMs : CACHE_TTL_MS;
+}
@@ -0,0 +1,20 @@
+import { octokit } from "./github";
+
+// A probe shouldn't hang as long as a tree request may
+const HEALTH_TIMEOUT_MS = 5_000;
+
+// Status of each dependency, "ok" or the error it failed with. The cache is
+// in-process and can't be down, so GitHub is the only real check; its
+// /rate_limit endpoint doesn't count against the rate limit.
+export async function checkHealth() {
+  const github = await octokit
+    .request("GET /rate_limit", {
+      request: { signal: AbortSignal.timeout(HEALTH_TIMEOUT_MS) },
+    })
+    .then(
+      () => "ok",
+      (err) => `error: ${err?.message || "unknown"}`
+    );
+
+  return { healthy: github === "ok", checks: { cache: "ok", github } };
+}
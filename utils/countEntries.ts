@@ -0,0 +1,22 @@
+import { TreeNode } from "./fetchRepoTree";
+
+// Directory and file counts as shown in the tree summary. Directories only
+// implied by the paths below them (e.g. after filtering) count too.
+export function countEntries(treeData: TreeNode[]) {
+  const dirs = new Set<string>();
+  let files = 0;
+
+  treeData.forEach((item) => {
+    if (item.type === "tree") dirs.add(item.path);
+    else files++;
+
+    let dir = item.path;
+    while (dir.includes("/")) {
+      dir = dir.slice(0, dir.lastIndexOf("/"));
+      if (dirs.has(dir)) break;
+      dirs.add(dir);
+    }
+  });
+
+  return { directories: dirs.size, files };
+}
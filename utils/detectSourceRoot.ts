@@ -0,0 +1,17 @@
+import { TreeNode } from "./fetchRepoTree";
+
+// Conventional source directories in priority order, overridable with a
+// comma-separated SOURCE_ROOTS env var (e.g. "src,packages/core/src,lib")
+const SOURCE_ROOTS = (Bun.env.SOURCE_ROOTS || "src,lib,app")
+  .split(",")
+  .map((dir) => dir.trim().replace(/^\/+|\/+$/g, ""))
+  .filter(Boolean);
+
+// First candidate (in priority order) that exists as a directory in the
+// tree, or null when the repo has none of them
+export function detectSourceRoot(treeData: TreeNode[]): string | null {
+  const dirs = new Set(
+    treeData.filter((item) => item.type === "tree").map((item) => item.path)
+  );
+  return SOURCE_ROOTS.find((dir) => dirs.has(dir)) ?? null;
+}
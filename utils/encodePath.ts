@@ -0,0 +1,9 @@
+// Encode each "/"-separated segment of a ref or file path for use in a URL,
+// keeping the slashes
+export const encodePath = (value: string) =>
+  value.split("/").map(encodeURIComponent).join("/");
+
+// Whether a ref has a "." or ".." segment, which git never allows and URL
+// parsing would resolve into a different API path
+export const hasDotSegment = (ref: string) =>
+  ref.split("/").some((segment) => segment === "." || segment === "..");
@@ -0,0 +1,41 @@
+import { afterEach, describe, expect, test } from "bun:test";
+import { envNumber } from "./envNumber";
+
+describe("envNumber", () => {
+  afterEach(() => {
+    delete Bun.env.GTREE_TEST_NUMBER;
+  });
+
+  test("falls back when unset or empty", () => {
+    expect(envNumber("GTREE_TEST_NUMBER", 30)).toBe(30);
+    Bun.env.GTREE_TEST_NUMBER = "";
+    expect(envNumber("GTREE_TEST_NUMBER", 30)).toBe(30);
+  });
+
+  test("parses numbers", () => {
+    Bun.env.GTREE_TEST_NUMBER = "1.5";
+    expect(envNumber("GTREE_TEST_NUMBER", 30)).toBe(1.5);
+    Bun.env.GTREE_TEST_NUMBER = " 0 ";
+    expect(envNumber("GTREE_TEST_NUMBER", 30)).toBe(0);
+  });
+
+  test("throws on values that aren't numbers", () => {
+    Bun.env.GTREE_TEST_NUMBER = "30s";
+    expect(() => envNumber("GTREE_TEST_NUMBER", 30)).toThrow(
+      'Invalid GTREE_TEST_NUMBER "30s"'
+    );
+    Bun.env.GTREE_TEST_NUMBER = "-1";
+    expect(() => envNumber("GTREE_TEST_NUMBER", 30)).toThrow();
+  });
+
+  test("enforces integer and positive", () => {
+    Bun.env.GTREE_TEST_NUMBER = "2.5";
+    expect(() =>
+      envNumber("GTREE_TEST_NUMBER", 3, { integer: true })
+    ).toThrow();
+    Bun.env.GTREE_TEST_NUMBER = "0";
+    expect(() =>
+      envNumber("GTREE_TEST_NUMBER", 3, { positive: true })
+    ).toThrow();
+  });
+});
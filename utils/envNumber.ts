@@ -0,0 +1,27 @@
+const NUMBER = /^\d+(?:\.\d+)?$/;
+const INTEGER = /^\d+$/;
+
+type EnvNumberOptions = {
+  // Only whole numbers are accepted
+  integer?: boolean;
+  // 0 is rejected too
+  positive?: boolean;
+};
+
+// Non-negative number from the environment variable name, or fallback when
+// it's unset. Anything else (a typo like "30s", a negative number) throws at
+// startup, rather than every request failing or a limit silently turning
+// off later.
+export function envNumber(
+  name: string,
+  fallback: number,
+  { integer = false, positive = false }: EnvNumberOptions = {}
+): number {
+  const value = Bun.env[name]?.trim();
+  if (!value) return fallback;
+  const parsed = Number(value);
+  const valid =
+    (integer ? INTEGER : NUMBER).test(value) && (!positive || parsed > 0);
+  if (!valid) throw new Error(`Invalid ${name} "${value}"`);
+  return parsed;
+}
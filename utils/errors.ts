@@ -0,0 +1,193 @@
+import type { Context } from "elysia";
+
+// Error carrying the HTTP status the route should respond with, and the
+// machine-readable code JSON clients get alongside the message
+export class HttpError extends Error {
+  status: number;
+  code: string;
+
+  constructor(status: number, message: string, code: string) {
+    super(message);
+    this.status = status;
+    this.code = code;
+  }
+}
+
+// Non-success response from the git provider's API
+export class UpstreamError extends Error {
+  status: number;
+
+  constructor(status: number) {
+    super(`Request failed with status ${status}`);
+    this.status = status;
+  }
+}
+
+// The provider refused the request because the API rate limit ran out
+export class RateLimitError extends UpstreamError {
+  // Unix time (ms) at which requests are accepted again
+  resetAt: number;
+
+  constructor(status: number, resetAt: number) {
+    super(status);
+    this.resetAt = resetAt;
+  }
+}
+
+// Last failure of a call that was retried, with the number of attempts in
+// the message. The original error is kept as cause (it may be a DOMException,
+// whose message can't be changed in place).
+export class RetriedError extends Error {
+  cause: unknown;
+
+  constructor(cause: unknown, attempts: number) {
+    const message = cause instanceof Error ? cause.message : String(cause);
+    super(`${message} after ${attempts} attempts`);
+    this.cause = cause;
+  }
+}
+
+// The provider couldn't be reached at all: the connection failed or the call
+// timed out before any response came back
+export class UnreachableError extends Error {
+  cause: unknown;
+
+  constructor(cause: unknown) {
+    const message = cause instanceof Error ? cause.message : String(cause);
+    super(`upstream unreachable: ${message}`);
+    this.cause = cause;
+  }
+}
+
+type HeaderLookup = (name: string) => string | null | undefined;
+
+// When a 403/429 response is a rate limit (no requests left, or a
+// Retry-After from GitHub's secondary limits), the time it resets at
+function rateLimitReset(status: number, header: HeaderLookup): number | null {
+  if (status !== 403 && status !== 429) return null;
+  const retryAfter = header("retry-after");
+  if (retryAfter) return Date.now() + Number(retryAfter) * 1000;
+  if (header("x-ratelimit-remaining") !== "0") return null;
+  const reset = Number(header("x-ratelimit-reset"));
+  return reset ? reset * 1000 : Date.now() + 60_000;
+}
+
+// Error for a non-success response, typed as a RateLimitError when the
+// headers say the rate limit was hit
+export function upstreamError(
+  status: number,
+  header: HeaderLookup
+): UpstreamError {
+  const resetAt = rateLimitReset(status, header);
+  return resetAt === null
+    ? new UpstreamError(status)
+    : new RateLimitError(status, resetAt);
+}
+
+// Reset time of a rate-limited upstream request, whether it came from our
+// fetchers or from octokit (whose errors carry the response headers)
+function rateLimitedUntil(err: any): number | null {
+  if (err instanceof RateLimitError) return err.resetAt;
+  const headers = err?.response?.headers;
+  if (typeof err?.status !== "number" || !headers) return null;
+  return rateLimitReset(err.status, (name) => headers[name]);
+}
+
+// Status the provider answered with, if err came from an upstream request
+function upstreamStatus(err: any): number | undefined {
+  if (err instanceof UpstreamError) return err.status;
+  // @octokit/request-error carries the response it failed on
+  if (typeof err?.status === "number" && err?.response) return err.status;
+}
+
+// Whether err means the provider is down, as opposed to a 4xx answer or a
+// bug of ours: it couldn't be reached, or it answered with a 5xx
+export function isUpstreamFailure(err: any): boolean {
+  const cause = err instanceof RetriedError ? err.cause : err;
+  if (cause instanceof UnreachableError) return true;
+  const status = upstreamStatus(cause);
+  return status !== undefined && status >= 500;
+}
+
+// Map an error raised while handling a request to the status, message and
+// code returned to the client
+export function describeError(err: any): {
+  status: number;
+  message: string;
+  code: string;
+  // Seconds the client should wait before retrying
+  retryAfter?: number;
+} {
+  if (err instanceof HttpError) {
+    return { status: err.status, message: err.message, code: err.code };
+  }
+  // Classified by the failure that was retried
+  const cause = err instanceof RetriedError ? err.cause : err;
+
+  const resetAt = rateLimitedUntil(cause);
+  if (resetAt !== null) {
+    return {
+      status: 429,
+      message: "upstream API rate limit exceeded, try again later",
+      code: "upstream_rate_limited",
+      retryAfter: Math.max(1, Math.ceil((resetAt - Date.now()) / 1000)),
+    };
+  }
+
+  const status = upstreamStatus(cause);
+  switch (status) {
+    case 404:
+      return {
+        status: 404,
+        message: "repository or branch not found",
+        code: "repo_not_found",
+      };
+    case 451:
+      return {
+        status: 451,
+        message: "repository unavailable for legal reasons",
+        code: "repo_unavailable",
+      };
+  }
+
+  // The provider failed, or couldn't be reached at all
+  if (status !== undefined || cause instanceof UnreachableError) {
+    return { status: 500, message: err.message, code: "upstream_error" };
+  }
+
+  return {
+    status: 500,
+    message: err?.message || "unknown",
+    code: "internal_error",
+  };
+}
+
+export const escapeHtml = (value: string) =>
+  value.replace(/[&<>"']/g, (char) => `&#${char.charCodeAt(0)};`);
+
+// Set the status and return the body for an error response. Clients asking
+// for JSON get { error, code }, where code is a stable identifier they can
+// branch on. Deployments can brand the other errors with ERROR_BODY_<status>
+// env vars (e.g. ERROR_BODY_404), plain text or HTML (detected by a leading
+// "<"), where {{status}} and {{message}} are substituted.
+export function errorResponse(
+  request: Request,
+  set: Context["set"],
+  status: number,
+  message: string,
+  code: string
+): string | { error: string; code: string } {
+  set.status = status;
+
+  const accept = request.headers.get("accept") || "";
+  if (accept.includes("application/json")) return { error: message, code };
+
+  const template = Bun.env[`ERROR_BODY_${status}`];
+  if (!template) return `Error: ${message}`;
+
+  const isHtml = template.trimStart().startsWith("<");
+  if (isHtml) set.headers["Content-Type"] = "text/html; charset=utf-8";
+  return template
+    .replaceAll("{{status}}", String(status))
+    .replaceAll("{{message}}", isHtml ? escapeHtml(message) : message);
+}
@@ -0,0 +1,76 @@
+import { TreeNode } from "./fetchRepoTree";
+import { expandBraces, globToRegExp } from "./glob";
+
+type IgnoreRule = {
+  re: RegExp;
+  anchored: boolean;
+  dirOnly: boolean;
+  negated: boolean;
+};
+
+// Parse patterns with .gitignore semantics:
+//   - a trailing "/" only matches directories ("dist/")
+//   - a pattern containing "/" elsewhere is anchored to the root
+//     ("/build", "docs/*.md"); one without matches the name at any depth
+//     ("node_modules", "*.lock")
+//   - a leading "!" re-includes what earlier patterns excluded ("\!" for a
+//     literal one)
+function compileIgnoreRules(patterns: string[]): IgnoreRule[] {
+  return patterns.flatMap(expandBraces).map((pattern) => {
+    const negated = pattern.startsWith("!");
+    const unprefixed = negated
+      ? pattern.slice(1)
+      : pattern.replace(/^\\!/, "!");
+    const dirOnly = unprefixed.endsWith("/");
+    const body = unprefixed.replace(/\/+$/, "");
+    const anchored = body.includes("/");
+    return {
+      re: globToRegExp(body.replace(/^\/+/, "")),
+      anchored,
+      dirOnly,
+      negated,
+    };
+  });
+}
+
+// Drop the entries excluded by the patterns, where the last one matching a
+// path decides, along with everything under an excluded directory (even when
+// the directory itself has no entry). As in git, nothing inside an excluded
+// directory can be re-included.
+export function excludePaths(
+  treeData: TreeNode[],
+  patterns: string[]
+): TreeNode[] {
+  const rules = compileIgnoreRules(patterns);
+  const excluded = new Map<string, boolean>();
+
+  const isExcluded = (path: string, isDir: boolean): boolean => {
+    const name = path.slice(path.lastIndexOf("/") + 1);
+    let result = false;
+    rules.forEach((rule) => {
+      if (!isDir && rule.dirOnly) return;
+      if (rule.re.test(rule.anchored ? path : name)) result = !rule.negated;
+    });
+    return result;
+  };
+
+  // Directories are checked once each and remembered
+  const isDirExcluded = (dir: string): boolean => {
+    let result = excluded.get(dir);
+    if (result === undefined) {
+      const slash = dir.lastIndexOf("/");
+      result =
+        (slash !== -1 && isDirExcluded(dir.slice(0, slash))) ||
+        isExcluded(dir, true);
+      excluded.set(dir, result);
+    }
+    return result;
+  };
+
+  return treeData.filter((item) => {
+    if (item.type === "tree") return !isDirExcluded(item.path);
+    const slash = item.path.lastIndexOf("/");
+    if (slash !== -1 && isDirExcluded(item.path.slice(0, slash))) return false;
+    return !isExcluded(item.path, false);
+  });
+}
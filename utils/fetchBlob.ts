@@ -0,0 +1,23 @@
+import { githubSignal, octokitFor } from "./github";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
+// Contents of a file by its blob sha, decoded as UTF-8
+export async function fetchBlob(
+  owner: string,
+  repo: string,
+  sha: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<string> {
+  const response = await withRetry(
+    budget,
+    () =>
+      octokitFor(token).request(
+        `GET /repos/${owner}/${repo}/git/blobs/${sha}`,
+        { request: { signal: githubSignal(budget) } }
+      ),
+    isTransient
+  );
+
+  return Buffer.from(response.data.content, "base64").toString("utf8");
+}
@@ -0,0 +1,28 @@
+import { encodePath } from "./encodePath";
+import { githubSignal, octokitFor } from "./github";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
+// SHA of the commit a branch, tag or SHA points to
+export async function fetchCommitSha(
+  owner: string,
+  repo: string,
+  ref: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<string> {
+  const response = await withRetry(
+    budget,
+    () =>
+      octokitFor(token).request(
+        `GET /repos/${owner}/${repo}/commits/${encodePath(ref)}`,
+        {
+          // Just the SHA, instead of the commit with its whole diff
+          mediaType: { format: "sha" },
+          request: { signal: githubSignal(budget) },
+        }
+      ),
+    isTransient
+  );
+
+  return String(response.data).trim();
+}
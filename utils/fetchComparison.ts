@@ -0,0 +1,50 @@
+import { encodePath } from "./encodePath";
+import { githubSignal, octokitFor } from "./github";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
+export type ChangedFile = {
+  path: string;
+  // added, removed, modified, renamed, copied, changed or unchanged
+  status: string;
+  previousPath?: string;
+};
+
+export type Comparison = {
+  baseSha: string;
+  headSha: string;
+  files: ChangedFile[];
+};
+
+// Files changed between two commits, given by SHA, via GitHub's compare API
+// (which lists at most 300 files)
+export async function fetchComparison(
+  owner: string,
+  repo: string,
+  base: string,
+  head: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<Comparison> {
+  const response = await withRetry(
+    budget,
+    () =>
+      octokitFor(token).request(
+        `GET /repos/${owner}/${repo}/compare/${encodePath(
+          base
+        )}...${encodePath(head)}`,
+        { request: { signal: githubSignal(budget) } }
+      ),
+    isTransient
+  );
+
+  const data = response.data;
+  return {
+    baseSha: base,
+    headSha: head,
+    files: (data.files ?? []).map((file: any) => ({
+      path: file.filename,
+      status: file.status,
+      previousPath: file.previous_filename,
+    })),
+  };
+}
@@ -1,13 +1,33 @@
-import { octokit } from "./github";
+import { githubSignal, octokitFor } from "./github";
+import { UpstreamError } from "./errors";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
 
-export async function fetchDefaultBranch(owner: string, repo: string) {
-  const response = await octokit.request(`GET /repos/${owner}/${repo}`);
+// Default branch of the repo along with its canonical owner/repo, which
+// differs from the requested one when the repo was renamed (GitHub
+// redirects the old name)
+export async function fetchDefaultBranch(
+  owner: string,
+  repo: string,
+  budget: RetryBudget,
+  token?: string
+) {
+  const response = await withRetry(
+    budget,
+    () =>
+      octokitFor(token).request(`GET /repos/${owner}/${repo}`, {
+        request: { signal: githubSignal(budget) },
+      }),
+    isTransient
+  );
 
   if (response.status !== 200) {
-    throw new Error(`Request failed with status ${response.status}`);
+    throw new UpstreamError(response.status);
   }
 
   const data = response.data;
 
-  return data.default_branch || "main";
+  return {
+    branch: (data.default_branch as string) || "main",
+    fullName: data.full_name as string,
+  };
 }
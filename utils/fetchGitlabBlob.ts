@@ -0,0 +1,18 @@
+import { gitlabRequest, projectPath } from "./gitlab";
+import { RetryBudget } from "./retryBudget";
+
+// GitLab counterpart of fetchBlob
+export async function fetchGitlabBlob(
+  owner: string,
+  repo: string,
+  sha: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<string> {
+  const response = await gitlabRequest(
+    `${projectPath(owner, repo)}/repository/blobs/${sha}/raw`,
+    budget,
+    token
+  );
+  return response.text();
+}
@@ -0,0 +1,19 @@
+import { gitlabRequest, projectPath } from "./gitlab";
+import { RetryBudget } from "./retryBudget";
+
+// GitLab counterpart of fetchDefaultBranch. Moved projects are still found
+// by their old path, and path_with_namespace gives the current one.
+export async function fetchGitlabDefaultBranch(
+  owner: string,
+  repo: string,
+  budget: RetryBudget,
+  token?: string
+) {
+  const response = await gitlabRequest(projectPath(owner, repo), budget, token);
+  const data = (await response.json()) as any;
+
+  return {
+    branch: (data.default_branch as string) || "main",
+    fullName: data.path_with_namespace as string,
+  };
+}
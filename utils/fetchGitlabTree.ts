@@ -0,0 +1,56 @@
+import { TreeNode } from "./fetchRepoTree";
+import { gitlabRequest, nextPage, projectPath } from "./gitlab";
+import { RetryBudget } from "./retryBudget";
+
+// GitLab lists trees a page at a time (100 entries at most), so huge repos
+// are cut off after MAX_PAGES pages and reported as truncated, like GitHub
+// does on its own
+const PER_PAGE = 100;
+const MAX_PAGES = 100;
+
+// GitLab counterpart of fetchRepoTree, returning the same shape. GitLab
+// doesn't list blob sizes, so size is left unset.
+export async function fetchGitlabTree(
+  owner: string,
+  repo: string,
+  branch: string,
+  budget: RetryBudget,
+  token?: string
+) {
+  const project = projectPath(owner, repo);
+  const ref = encodeURIComponent(branch);
+
+  // The ref may be a branch, tag or SHA; resolve it to the commit listed
+  const commitResponse = await gitlabRequest(
+    `${project}/repository/commits/${ref}`,
+    budget,
+    token
+  );
+  const commit = (await commitResponse.json()) as {
+    id: string;
+    committed_date: string;
+  };
+
+  const tree: TreeNode[] = [];
+  let page: string | null = `${project}/repository/tree?recursive=true&ref=${ref}&per_page=${PER_PAGE}&pagination=keyset`;
+  for (let pages = 0; page && pages < MAX_PAGES; pages++) {
+    const response = await gitlabRequest(page, budget, token);
+    const items = (await response.json()) as {
+      path: string;
+      type: string;
+      id: string;
+    }[];
+    items.forEach((item) => {
+      tree.push({ path: item.path, type: item.type, sha: item.id });
+    });
+    page = nextPage(response.headers.get("link"));
+  }
+
+  return {
+    sha: commit.id,
+    committedAt: commit.committed_date,
+    tree,
+    truncated: page !== null,
+    redirected: false,
+  };
+}
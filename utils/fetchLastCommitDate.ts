@@ -0,0 +1,28 @@
+import { githubSignal, octokitFor } from "./github";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
+// Date of the most recent commit on branch that touched path ("" for any
+// commit), or null when there is none
+export async function fetchLastCommitDate(
+  owner: string,
+  repo: string,
+  branch: string,
+  path: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<string | null> {
+  const response = await withRetry(
+    budget,
+    () =>
+      octokitFor(token).request(`GET /repos/${owner}/${repo}/commits`, {
+        sha: branch,
+        ...(path && { path }),
+        per_page: 1,
+        request: { signal: githubSignal(budget) },
+      }),
+    isTransient
+  );
+
+  const [latest] = response.data;
+  return latest?.commit?.committer?.date ?? null;
+}
@@ -1,26 +1,123 @@
+import { encodePath } from "./encodePath";
+import { UpstreamError, upstreamError } from "./errors";
+import { githubSignal } from "./github";
+import { trackUpstream } from "./metrics";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
 export type TreeNode = {
   path: string;
   type: string;
+  sha: string;
+  // Bytes, only present on blobs
+  size?: number;
 };
 
 export type ApiResponse = {
+  // The commit the tree was listed at
+  sha: string;
   tree: TreeNode[];
+  truncated: boolean;
+  // ETag of the ref's commit lookup, sent back as If-None-Match when the
+  // tree is fetched again
+  etag?: string;
+  // Entries dropped from the end of tree for exceeding MAX_TREE_NODES
+  omitted?: number;
+  // Date of that commit (unset for an empty repo)
+  committedAt?: string;
 };
 
 export async function fetchRepoTree(
   owner: string,
   repo: string,
-  branch: string
+  branch: string,
+  budget: RetryBudget,
+  token?: string,
+  // Earlier copy of the tree, revalidated with its ETag instead of being
+  // downloaded again when it's unchanged
+  previous?: ApiResponse
 ) {
-  const response = await fetch(
-    `https://api.github.com/repos/${owner}/${repo}/git/trees/${branch}?recursive=true`
-  );
+  const auth = token ?? Bun.env.GITHUB_TOKEN;
+  const headers: Record<string, string> = auth
+    ? { Authorization: `token ${auth}` }
+    : {};
+
+  const repoUrl = `https://api.github.com/repos/${owner}/${repo}`;
+
+  // fetch() only rejects on network failure. 5xx responses are thrown too
+  // so they get retried along with it.
+  const request = (url: string, etag?: string) =>
+    withRetry(
+      budget,
+      async () => {
+        const response = await trackUpstream("github", () =>
+          fetch(url, {
+            headers: etag ? { ...headers, "If-None-Match": etag } : headers,
+            signal: githubSignal(budget),
+          })
+        );
+        if (response.status >= 500) throw new UpstreamError(response.status);
+        return response;
+      },
+      isTransient
+    );
+
+  // The trees API only knows the tree's own sha, so the ref (a branch, tag
+  // or SHA) is resolved to its commit first. Refs may contain "/" (kept as
+  // the path separator GitHub expects) and characters like "#" that would
+  // otherwise end the path.
+  const commitUrl = `${repoUrl}/commits/${encodePath(branch)}`;
+  let commitResponse = await request(commitUrl, previous?.etag);
+  // Same commit, and a 304 doesn't count against the rate limit. Without a
+  // previous tree to reuse, fall back to a full fetch.
+  if (commitResponse.status === 304) {
+    if (previous) {
+      return { ...previous, redirected: commitResponse.redirected };
+    }
+    commitResponse = await request(commitUrl);
+  }
 
-  if (response.status !== 200) {
-    throw new Error(`Request failed with status ${response.status}`);
+  // A repo without any commits has no tree to list
+  if (commitResponse.status === 409) {
+    return {
+      sha: "",
+      tree: [],
+      truncated: false,
+      redirected: commitResponse.redirected,
+    };
+  }
+
+  // GitHub answers 422 for a SHA that matches no commit
+  const commitStatus =
+    commitResponse.status === 422 ? 404 : commitResponse.status;
+  if (commitStatus !== 200) {
+    throw upstreamError(commitStatus, (name) =>
+      commitResponse.headers.get(name)
+    );
+  }
+
+  const commit = (await commitResponse.json()) as {
+    sha: string;
+    commit: { committer: { date: string }; tree: { sha: string } };
+  };
+  const treeResponse = await request(
+    `${repoUrl}/git/trees/${commit.commit.tree.sha}?recursive=true`
+  );
+  if (treeResponse.status !== 200) {
+    throw upstreamError(treeResponse.status, (name) =>
+      treeResponse.headers.get(name)
+    );
   }
 
-  const data = await response.json();
+  const data = (await treeResponse.json()) as ApiResponse;
 
-  return data as ApiResponse;
+  // A redirect means the repo was renamed. GitHub redirects to
+  // /repositories/:id, so callers have to look up the new name themselves.
+  return {
+    sha: commit.sha,
+    committedAt: commit.commit.committer.date,
+    tree: data.tree,
+    truncated: data.truncated,
+    etag: commitResponse.headers.get("etag") ?? undefined,
+    redirected: commitResponse.redirected || treeResponse.redirected,
+  };
 }
@@ -0,0 +1,68 @@
+// Emoji shown before entries with ?icons=true. Extend EXTENSION_ICONS (or
+// FILENAME_ICONS for names without a telling extension) to cover more types.
+const DIRECTORY_ICON = "📁";
+const DEFAULT_ICON = "📄";
+
+const FILENAME_ICONS: Record<string, string> = {
+  dockerfile: "🐳",
+  makefile: "🛠️",
+  license: "📜",
+  "package.json": "📦",
+  "go.mod": "📦",
+  "cargo.toml": "📦",
+};
+
+const EXTENSION_ICONS: Record<string, string> = {
+  go: "🐹",
+  rs: "🦀",
+  py: "🐍",
+  rb: "💎",
+  js: "🟨",
+  mjs: "🟨",
+  ts: "🔷",
+  tsx: "🔷",
+  jsx: "⚛️",
+  java: "☕",
+  php: "🐘",
+  swift: "🐦",
+  c: "🔧",
+  h: "🔧",
+  cpp: "🔧",
+  sh: "🐚",
+  md: "📝",
+  txt: "📝",
+  json: "🔣",
+  yml: "⚙️",
+  yaml: "⚙️",
+  toml: "⚙️",
+  html: "🌐",
+  css: "🎨",
+  scss: "🎨",
+  png: "🖼️",
+  jpg: "🖼️",
+  jpeg: "🖼️",
+  gif: "🖼️",
+  svg: "🖼️",
+  webp: "🖼️",
+  ico: "🖼️",
+  mp3: "🎵",
+  wav: "🎵",
+  mp4: "🎬",
+  zip: "🗜️",
+  gz: "🗜️",
+  tar: "🗜️",
+  pdf: "📕",
+  lock: "🔒",
+};
+
+// Icon for an entry named name (not a full path)
+export function iconFor(name: string, isDir: boolean): string {
+  if (isDir) return DIRECTORY_ICON;
+  const lower = name.toLowerCase();
+  const dot = lower.lastIndexOf(".");
+  return (
+    FILENAME_ICONS[lower] ??
+    (dot > 0 ? EXTENSION_ICONS[lower.slice(dot + 1)] : undefined) ??
+    DEFAULT_ICON
+  );
+}
@@ -0,0 +1,9 @@
+import { TreeNode } from "./fetchRepoTree";
+
+// Keep only the entries below dir, with paths re-rooted relative to it
+export function filterSubtree(treeData: TreeNode[], dir: string): TreeNode[] {
+  const prefix = `${dir}/`;
+  return treeData
+    .filter((item) => item.path.startsWith(prefix))
+    .map((item) => ({ ...item, path: item.path.slice(prefix.length) }));
+}
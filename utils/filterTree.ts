@@ -0,0 +1,75 @@
+import { HttpError } from "./errors";
+import { detectSourceRoot } from "./detectSourceRoot";
+import { excludePaths } from "./excludePaths";
+import { TreeNode } from "./fetchRepoTree";
+import { filterSubtree } from "./filterSubtree";
+import { compileGlobs } from "./glob";
+import { keepWithAncestors } from "./keepWithAncestors";
+import { Options } from "./parseOptions";
+
+// Apply the query's filters to a repo's full tree, after dropping what the
+// repo's own ignore file (ignored, anchored at the repo root) excludes.
+// Returns the remaining entries, with paths relative to base, the directory
+// the output is rooted at ("" for the repo root).
+export function filterTree(
+  fullTree: TreeNode[],
+  options: Options,
+  ignored: string[] = []
+): { tree: TreeNode[]; base: string } {
+  let tree = ignored.length > 0 ? excludePaths(fullTree, ignored) : fullTree;
+
+  let base = options.path;
+  if (base) {
+    const found = tree.some(
+      (item) => item.type === "tree" && item.path === base
+    );
+    if (!found) {
+      throw new HttpError(
+        404,
+        `path not found in repo: ${base}`,
+        "path_not_found"
+      );
+    }
+    tree = filterSubtree(tree, base);
+  }
+
+  if (options.sourceRoot === "auto") {
+    const root = detectSourceRoot(tree);
+    if (root) {
+      tree = filterSubtree(tree, root);
+      base = base ? `${base}/${root}` : root;
+    }
+  }
+
+  // Exclusions go first so include can't bring excluded paths back
+  if (options.exclude.length > 0) {
+    tree = excludePaths(tree, options.exclude);
+  }
+
+  if (options.include.length > 0) {
+    const matches = compileGlobs(options.include);
+    tree = keepWithAncestors(tree, (item) => matches(item.path));
+  }
+
+  if (options.minSize > 0) {
+    tree = keepWithAncestors(
+      tree,
+      (item) => item.type === "blob" && (item.size ?? 0) >= options.minSize
+    );
+  }
+
+  // Files keep their directories so they're still shown in context
+  if (options.type === "dir") {
+    tree = tree.filter((item) => item.type === "tree");
+  } else if (options.type === "file") {
+    tree = keepWithAncestors(tree, (item) => item.type !== "tree");
+  }
+
+  // Applied to the cached full tree, so every depth shares one fetch
+  if (options.depth > 0) {
+    const depth = options.depth;
+    tree = tree.filter((item) => item.path.split("/").length <= depth);
+  }
+
+  return { tree, base };
+}
@@ -0,0 +1,12 @@
+const UNITS = ["B", "KB", "MB", "GB", "TB"];
+
+// Human-readable size with 1024-based units, e.g. 1234 -> "1.2 KB"
+export function formatSize(bytes: number): string {
+  let value = bytes;
+  let unit = 0;
+  while (value >= 1024 && unit < UNITS.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+  return unit === 0 ? `${value} B` : `${value.toFixed(1)} ${UNITS[unit]}`;
+}
@@ -0,0 +1,53 @@
+import { getCache, setCache, tokenScope } from "./cache";
+import { TreeNode } from "./fetchRepoTree";
+import { fetchLastCommitDate } from "./fetchLastCommitDate";
+import { mapLimit } from "./mapLimit";
+import { RetryBudget, throwIfTimedOut } from "./retryBudget";
+
+// Every directory costs one commits API call (cached like trees), so only
+// the first ACTIVITY_MAX_DIRS top-level directories are looked up,
+// ACTIVITY_CONCURRENCY at a time
+const ACTIVITY_MAX_DIRS = 50;
+const ACTIVITY_CONCURRENCY = 5;
+
+// Latest commit date (YYYY-MM-DD) of each top-level directory of treeData,
+// which may have been re-rooted at base. Lookups that fail are left out.
+export async function getActivity(
+  owner: string,
+  repo: string,
+  branch: string,
+  base: string,
+  treeData: TreeNode[],
+  budget: RetryBudget,
+  token?: string
+): Promise<Map<string, string>> {
+  const activity = new Map<string, string>();
+  const scope = tokenScope(token);
+  const dirs = treeData
+    .filter((item) => item.type === "tree" && !item.path.includes("/"))
+    .slice(0, ACTIVITY_MAX_DIRS)
+    .map((item) => item.path);
+
+  await mapLimit(dirs, ACTIVITY_CONCURRENCY, async (dir) => {
+    const path = base ? `${base}/${dir}` : dir;
+    const key = `${scope}activity:${owner}:${repo}:${branch}:${path}`;
+    let date = getCache<string>(key);
+    if (!date) {
+      date = await fetchLastCommitDate(
+        owner,
+        repo,
+        branch,
+        path,
+        budget,
+        token
+      ).catch(() => {
+        throwIfTimedOut(budget);
+        return null;
+      });
+      if (date) setCache(key, date);
+    }
+    if (date) activity.set(dir, date.slice(0, 10));
+  });
+
+  return activity;
+}
@@ -0,0 +1,56 @@
+import { CACHE_TTL_MS, getCache, setCache, tokenScope } from "./cache";
+import { Comparison, fetchComparison } from "./fetchComparison";
+import { fetchCommitSha } from "./fetchCommitSha";
+import { RetryBudget } from "./retryBudget";
+
+// A comparison between two commit SHAs can never change, so it is cached
+// much longer than what a branch or tag points to
+const IMMUTABLE_TTL_MS = 24 * 60 * 60 * 1000;
+const isSha = (ref: string) => /^[0-9a-f]{40}$/i.test(ref);
+
+// Commit SHA of ref, cached like trees unless ref already is one
+async function resolveRef(
+  owner: string,
+  repo: string,
+  ref: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<string> {
+  if (isSha(ref)) return ref.toLowerCase();
+  const key = `${tokenScope(token)}ref:${owner}:${repo}:${ref}`;
+  const cached = getCache<string>(key);
+  if (cached) return cached;
+
+  const sha = await fetchCommitSha(owner, repo, ref, budget, token);
+  setCache(key, sha, CACHE_TTL_MS);
+  return sha;
+}
+
+// Files changed between base and head, cached by the pair of commit SHAs
+// they resolve to
+export async function getComparison(
+  owner: string,
+  repo: string,
+  base: string,
+  head: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<{ comparison: Comparison; cacheHit: boolean }> {
+  const [baseSha, headSha] = await Promise.all(
+    [base, head].map((ref) => resolveRef(owner, repo, ref, budget, token))
+  );
+  const key = `${tokenScope(token)}compare:${owner}:${repo}:${baseSha}...${headSha}`;
+  const cached = getCache<Comparison>(key);
+  if (cached) return { comparison: cached, cacheHit: true };
+
+  const comparison = await fetchComparison(
+    owner,
+    repo,
+    baseSha,
+    headSha,
+    budget,
+    token
+  );
+  setCache(key, comparison, IMMUTABLE_TTL_MS);
+  return { comparison, cacheHit: false };
+}
@@ -0,0 +1,57 @@
+import { getCache, setCache } from "./cache";
+import { TreeNode } from "./fetchRepoTree";
+import { providers } from "./providers";
+import { RetryBudget, throwIfTimedOut } from "./retryBudget";
+
+// Checked at the repo root in this order; the first one present is used
+const IGNORE_FILES = [".gtreeignore", ".gitignore"];
+// Patterns are cached by the file's blob sha, so they never go stale
+const IGNORE_TTL_MS = 24 * 60 * 60 * 1000;
+
+// Patterns of a gitignore-style file: one per line, skipping blank lines and
+// # comments. Negated (!) patterns are kept, and applied by excludePaths.
+function parseIgnoreFile(contents: string): string[] {
+  return contents
+    .split(/\r?\n/)
+    .map((line) => line.trimEnd())
+    .filter((line) => line && !line.startsWith("#"))
+    .map((line) => line.replace(/^\\#/, "#"));
+}
+
+// Patterns from the repo's .gtreeignore (or .gitignore), found through the
+// tree listing so repos without one cost no extra request. A file that is
+// gone by the time it's fetched counts as missing. Null when it couldn't be
+// fetched, in which case the tree is shown unfiltered.
+export async function getIgnorePatterns(
+  provider: string,
+  owner: string,
+  repo: string,
+  treeData: TreeNode[],
+  budget: RetryBudget,
+  token?: string
+): Promise<string[] | null> {
+  const file = IGNORE_FILES.map((name) =>
+    treeData.find((item) => item.type === "blob" && item.path === name)
+  ).find(Boolean);
+  if (!file) return [];
+
+  const key = `ignore:${file.sha}`;
+  const cached = getCache<string[]>(key);
+  if (cached) return cached;
+
+  try {
+    const contents = await providers[provider].fetchBlob(
+      owner,
+      repo,
+      file.sha,
+      budget,
+      token
+    );
+    const patterns = parseIgnoreFile(contents);
+    setCache(key, patterns, IGNORE_TTL_MS);
+    return patterns;
+  } catch (err: any) {
+    throwIfTimedOut(budget);
+    return err?.status === 404 ? [] : null;
+  }
+}
@@ -0,0 +1,96 @@
+import { afterAll, beforeAll, describe, expect, test } from "bun:test";
+import { getTree } from "./getTree";
+import { providers } from "./providers";
+import { createRetryBudget } from "./retryBudget";
+
+// A provider where old-owner/old-name was renamed to new-owner/new-name:
+// fetching the tree under the old name follows a redirect
+describe("renamed repositories", () => {
+  const github = providers.github;
+  const fetched: string[] = [];
+
+  beforeAll(() => {
+    providers.github = {
+      ...github,
+      fetchDefaultBranch: async () => ({
+        branch: "main",
+        fullName: "new-owner/new-name",
+      }),
+      fetchRepoTree: async (owner, repo, branch) => {
+        fetched.push(`${owner}/${repo}/${branch}`);
+        return {
+          sha: "abc123",
+          tree: [{ path: "README.md", type: "blob", sha: "def456" }],
+          truncated: false,
+          redirected: owner === "old-owner",
+        };
+      },
+    };
+  });
+
+  afterAll(() => {
+    providers.github = github;
+  });
+
+  const get = (owner: string, repo: string) =>
+    getTree(
+      { provider: "github", owner, repo, branch: "main" },
+      createRetryBudget()
+    );
+
+  test("resolve to the canonical owner/repo", async () => {
+    const result = await get("old-owner", "old-name");
+    expect(result.owner).toBe("new-owner");
+    expect(result.repo).toBe("new-name");
+    expect(result.cacheHit).toBe(false);
+  });
+
+  test("are cached under the canonical name", async () => {
+    const canonical = await get("new-owner", "new-name");
+    expect(canonical.cacheHit).toBe(true);
+
+    const old = await get("old-owner", "old-name");
+    expect(old.cacheHit).toBe(true);
+    expect(`${old.owner}/${old.repo}`).toBe("new-owner/new-name");
+    expect(fetched).toEqual(["old-owner/old-name/main"]);
+  });
+});
+
+// A GitLab project that moved into a subgroup, which owner/repo can't name
+describe("projects moved into a subgroup", () => {
+  const gitlab = providers.gitlab;
+  const fetched: string[] = [];
+
+  beforeAll(() => {
+    providers.gitlab = {
+      ...gitlab,
+      fetchDefaultBranch: async () => ({
+        branch: "main",
+        fullName: "group/sub/project",
+      }),
+      fetchRepoTree: async (owner, repo, branch) => {
+        fetched.push(`${owner}/${repo}/${branch}`);
+        return {
+          sha: "abc123",
+          tree: [{ path: "README.md", type: "blob", sha: "def456" }],
+          truncated: false,
+          redirected: false,
+        };
+      },
+    };
+  });
+
+  afterAll(() => {
+    providers.gitlab = gitlab;
+  });
+
+  test("keep the requested name", async () => {
+    const target = { provider: "gitlab", owner: "group", repo: "project" };
+    const first = await getTree(target, createRetryBudget());
+    expect(`${first.owner}/${first.repo}`).toBe("group/project");
+
+    const second = await getTree(target, createRetryBudget());
+    expect(`${second.owner}/${second.repo}`).toBe("group/project");
+    expect(fetched).toEqual(["group/project/main"]);
+  });
+});
@@ -0,0 +1,213 @@
+import { cacheExpiresIn, cacheScope, getCache, setCache } from "./cache";
+import { treeTtl } from "./cacheTtl";
+import { recordCacheLookup } from "./metrics";
+import { envNumber } from "./envNumber";
+import { HttpError, isUpstreamFailure, UpstreamError } from "./errors";
+import { ApiResponse } from "./fetchRepoTree";
+import { RepoPath } from "./parseRepoPath";
+import { providers } from "./providers";
+import { RetryBudget } from "./retryBudget";
+import { singleflight } from "./singleflight";
+
+// Renames are permanent, so remember them longer than cached trees
+const ALIAS_TTL_MS = 24 * 60 * 60 * 1000;
+// Expired trees are kept this long under stale: keys so a refetch can be a
+// conditional request, answered with a cheap 304 when nothing changed. They
+// (and stale default branches) are also served while the provider is down.
+const STALE_TTL_MS = 24 * 60 * 60 * 1000;
+
+// Share of the usual TTL that truncated trees stay cached for
+const TRUNCATED_TTL_FACTOR = 0.25;
+
+// Entries kept per tree. Anything past it is dropped before the tree is
+// cached or rendered, bounding memory for pathologically large repos.
+const MAX_TREE_NODES = envNumber("MAX_TREE_NODES", 50_000, {
+  integer: true,
+  positive: true,
+});
+
+export type ResolvedTree = {
+  // Canonical owner/repo, which differs from the requested one after a rename
+  owner: string;
+  repo: string;
+  branch: string;
+  data: ApiResponse;
+  cacheHit: boolean;
+  // Served from an expired copy because the provider couldn't be reached
+  // or failed
+  stale: boolean;
+  // Seconds until the cached tree expires (0 when it wasn't cached)
+  maxAge: number;
+};
+
+// Resolve the branch (the default one when unset) and return the repo's
+// tree, from the cache when possible. With a caller's token the results are
+// cached separately from the shared ones. fresh skips cache reads (the
+// results are still cached). Concurrent misses share one upstream fetch,
+// which runs on the first caller's remaining retries and deadline and is
+// aborted once every caller waiting for it has gone away.
+export async function getTree(
+  target: RepoPath,
+  budget: RetryBudget,
+  token?: string,
+  fresh: boolean = false
+): Promise<ResolvedTree> {
+  const provider = providers[target.provider];
+  const scope = cacheScope(target.provider, token);
+  let { owner, repo, branch } = target;
+  let stale = false;
+  // Expired copy under staleKey, to use instead when err is the provider
+  // failing. Otherwise err is rethrown.
+  const staleFallback = <T>(staleKey: string, err: unknown): T => {
+    const copy = getCache<T>(staleKey);
+    if (copy === null || !isUpstreamFailure(err)) throw err;
+    stale = true;
+    return copy;
+  };
+  // Run a fetch shared through singleflight (which passes signal) on this
+  // caller's budget. Retries it takes are charged to this caller, but only
+  // signal, not this caller going away, aborts it.
+  const onSharedBudget = async <T>(
+    signal: AbortSignal,
+    run: (shared: RetryBudget) => Promise<T>
+  ): Promise<T> => {
+    const shared = { ...budget, signal };
+    try {
+      return await run(shared);
+    } finally {
+      budget.attempts = Math.min(budget.attempts, shared.attempts);
+    }
+  };
+
+  // Renamed repos redirect on GitHub. Once a rename has been seen, requests
+  // for the old name use the canonical owner/repo so they share its cache
+  // entries.
+  const aliasKey = `${scope}alias:${owner}:${repo}`;
+  const alias = getCache<string>(aliasKey);
+  if (alias) [owner, repo] = alias.split("/");
+  // GitLab projects can move into subgroups (group/sub/project), which
+  // owner/repo can't address, so those keep the requested name
+  const useCanonical = (fullName: string) => {
+    if (fullName === `${owner}/${repo}`) return;
+    if (fullName.split("/").length !== 2) return;
+    setCache(aliasKey, fullName, ALIAS_TTL_MS);
+    [owner, repo] = fullName.split("/");
+  };
+
+  if (!branch) {
+    const branchKey = () => `${scope}default_branch:${owner}:${repo}`;
+    if (!fresh) {
+      branch = getCache<string>(branchKey()) ?? undefined;
+      recordCacheLookup("branch", branch !== undefined);
+    }
+    if (!branch) {
+      const key = branchKey();
+      const staleKey = `${scope}stale:default_branch:${owner}:${repo}`;
+      const info = await singleflight(
+        key,
+        (signal) =>
+          onSharedBudget(signal, async (shared) => {
+            const info = await provider.fetchDefaultBranch(
+              owner,
+              repo,
+              shared,
+              token
+            );
+            setCache(key, info.branch);
+            setCache(staleKey, info.branch, STALE_TTL_MS);
+            return info;
+          }),
+        budget.signal
+      ).catch((err) => ({
+        branch: staleFallback<string>(staleKey, err),
+        fullName: `${owner}/${repo}`,
+      }));
+      useCanonical(info.fullName);
+      branch = info.branch;
+    }
+  }
+
+  const treeKey = `${scope}tree:${owner}:${repo}:${branch}`;
+  const cached = fresh ? null : getCache<ApiResponse>(treeKey);
+  if (!fresh) recordCacheLookup("tree", cached !== null);
+  if (cached) {
+    const maxAge = cacheExpiresIn(treeKey);
+    return {
+      owner,
+      repo,
+      branch,
+      data: cached,
+      cacheHit: true,
+      stale,
+      maxAge,
+    };
+  }
+
+  const resolvedBranch = branch;
+  const staleKey = `${scope}stale:tree:${owner}:${repo}:${branch}`;
+  const fetchTree = async (shared: RetryBudget) => {
+    const { redirected, ...fetched } = await provider
+      .fetchRepoTree(
+        owner,
+        repo,
+        resolvedBranch,
+        shared,
+        token,
+        getCache<ApiResponse>(staleKey) ?? undefined
+      )
+      .catch(async (err) => {
+        // The ref can be a branch, tag or commit SHA. A 404 for one given in
+        // the path is only the ref's fault if the repo itself exists.
+        if (!target.branch || !(err instanceof UpstreamError)) throw err;
+        if (err.status !== 404) throw err;
+        await provider.fetchDefaultBranch(owner, repo, shared, token);
+        throw new HttpError(
+          404,
+          `ref not found: ${resolvedBranch}`,
+          "ref_not_found"
+        );
+      });
+    const data: ApiResponse =
+      fetched.tree.length > MAX_TREE_NODES
+        ? {
+            ...fetched,
+            tree: fetched.tree.slice(0, MAX_TREE_NODES),
+            omitted: fetched.tree.length - MAX_TREE_NODES,
+          }
+        : fetched;
+    let fullName = `${owner}/${repo}`;
+    if (redirected) {
+      const info = await provider.fetchDefaultBranch(
+        owner,
+        repo,
+        shared,
+        token
+      );
+      // Only an owner/repo name can be aliased (see useCanonical)
+      if (info.fullName.split("/").length === 2) fullName = info.fullName;
+    }
+    // A truncated listing keeps its truncated flag, so it's never mistaken
+    // for the full tree, and expires sooner in case a retry gets more
+    const [canonicalOwner, canonicalRepo] = fullName.split("/");
+    const key = `tree:${canonicalOwner}:${canonicalRepo}:${resolvedBranch}`;
+    const ttl = treeTtl(target.provider, canonicalOwner, canonicalRepo);
+    setCache(
+      `${scope}${key}`,
+      data,
+      data.truncated ? Math.ceil(ttl * TRUNCATED_TTL_FACTOR) : ttl
+    );
+    setCache(`${scope}stale:${key}`, data, STALE_TTL_MS);
+    return { data, fullName };
+  };
+  const { data, fullName } = await singleflight(
+    treeKey,
+    (signal) => onSharedBudget(signal, fetchTree),
+    budget.signal
+  ).catch((err) => ({
+    data: staleFallback<ApiResponse>(staleKey, err),
+    fullName: `${owner}/${repo}`,
+  }));
+  useCanonical(fullName);
+  const maxAge = cacheExpiresIn(`${scope}tree:${owner}:${repo}:${branch}`);
+  return { owner, repo, branch, data, cacheHit: false, stale, maxAge };
+}
@@ -0,0 +1,78 @@
+import { afterAll, beforeAll, describe, expect, test } from "bun:test";
+import { fetchDefaultBranch } from "./fetchDefaultBranch";
+import { fetchRepoTree } from "./fetchRepoTree";
+import { createRetryBudget, RetryBudget } from "./retryBudget";
+
+// As configured for the tests in .env.test
+const TIMEOUT_MS = Number(Bun.env.GITHUB_TIMEOUT_SECONDS ?? 10) * 1000;
+
+// Budget without retries, so each test makes a single call
+const singleAttempt = (signal?: AbortSignal): RetryBudget => ({
+  ...createRetryBudget(signal),
+  attempts: 0,
+});
+
+describe("GitHub calls to a slow server", () => {
+  // Never answers within GITHUB_TIMEOUT_SECONDS
+  const server = Bun.serve({
+    port: 0,
+    async fetch() {
+      await Bun.sleep(TIMEOUT_MS + 5000);
+      return new Response("too late");
+    },
+  });
+  const realFetch = globalThis.fetch;
+
+  // Send every request (the fetchers' and octokit's) to the slow server
+  beforeAll(() => {
+    globalThis.fetch = ((input: string | URL | Request, init?: RequestInit) => {
+      const url = new URL(input instanceof Request ? input.url : input);
+      return realFetch(new URL(url.pathname + url.search, server.url), init);
+    }) as typeof fetch;
+  });
+
+  afterAll(() => {
+    globalThis.fetch = realFetch;
+    server.stop(true);
+  });
+
+  test(
+    "time out a tree fetch after GITHUB_TIMEOUT_SECONDS",
+    async () => {
+      const started = Date.now();
+      const request = fetchRepoTree("owner", "repo", "main", singleAttempt());
+      await expect(request).rejects.toThrow(/upstream unreachable/);
+      const elapsed = Date.now() - started;
+      expect(elapsed).toBeGreaterThanOrEqual(TIMEOUT_MS - 50);
+      expect(elapsed).toBeLessThan(TIMEOUT_MS + 2000);
+    },
+    TIMEOUT_MS + 5000
+  );
+
+  test(
+    "time out a default branch lookup after GITHUB_TIMEOUT_SECONDS",
+    async () => {
+      const started = Date.now();
+      const request = fetchDefaultBranch("owner", "repo", singleAttempt());
+      await expect(request).rejects.toThrow(/upstream unreachable/);
+      const elapsed = Date.now() - started;
+      expect(elapsed).toBeGreaterThanOrEqual(TIMEOUT_MS - 50);
+      expect(elapsed).toBeLessThan(TIMEOUT_MS + 2000);
+    },
+    TIMEOUT_MS + 5000
+  );
+
+  test("abort a tree fetch as soon as the client goes away", async () => {
+    const client = new AbortController();
+    const request = fetchRepoTree(
+      "owner",
+      "repo",
+      "main",
+      singleAttempt(client.signal)
+    );
+    setTimeout(() => client.abort(), 50);
+    const started = Date.now();
+    await expect(request).rejects.toThrow(/upstream unreachable/);
+    expect(Date.now() - started).toBeLessThan(TIMEOUT_MS);
+  });
+});
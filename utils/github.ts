@@ -1,5 +1,44 @@
 import { Octokit } from "@octokit/core";
+import { envNumber } from "./envNumber";
+import { trackUpstream } from "./metrics";
+import { RetryBudget } from "./retryBudget";
 
-export const octokit = new Octokit({
-  auth: Bun.env.GITHUB_TOKEN,
-});
+// How long a single GitHub API call may take before it's aborted
+const GITHUB_TIMEOUT_MS =
+  envNumber("GITHUB_TIMEOUT_SECONDS", 10, { positive: true }) * 1000;
+
+// Client whose every request is recorded in the upstream metrics
+function createOctokit(auth?: string): Octokit {
+  const client = new Octokit({ auth });
+  client.hook.wrap("request", (request, options) =>
+    trackUpstream("github", () => request(options))
+  );
+  return client;
+}
+
+export const octokit = createOctokit(Bun.env.GITHUB_TOKEN);
+
+// Client authenticated with the caller's own token, or the shared one
+export function octokitFor(token?: string): Octokit {
+  return token ? createOctokit(token) : octokit;
+}
+
+// Signal for one GitHub call, aborted once it takes longer than
+// GITHUB_TIMEOUT_SECONDS or as soon as the budget's signal aborts: the
+// client disconnecting or the request deadline passing, or for a fetch
+// shared by several requests, every one of them having gone away
+export function githubSignal(budget: RetryBudget): AbortSignal {
+  const timeout = AbortSignal.timeout(GITHUB_TIMEOUT_MS);
+  return budget.signal ? AbortSignal.any([timeout, budget.signal]) : timeout;
+}
+
+// Token the caller sent for their own (e.g. private) repositories, from an
+// "Authorization: token <t>" header or a ?token= parameter. Bearer tokens
+// are never used: that scheme carries ADMIN_TOKEN (or a gateway's own
+// credentials), which must not be forwarded upstream.
+export function requestToken(request: Request): string | undefined {
+  const header = request.headers.get("authorization");
+  const match = header?.match(/^token\s+(\S+)$/i);
+  if (match) return match[1];
+  return new URL(request.url).searchParams.get("token") || undefined;
+}
@@ -0,0 +1,67 @@
+import { encodePath } from "./encodePath";
+import { UpstreamError, upstreamError } from "./errors";
+import { githubSignal } from "./github";
+import { trackUpstream } from "./metrics";
+import { isTransient, RetryBudget, withRetry } from "./retryBudget";
+
+// gitlab.com unless GITLAB_URL points at a self-hosted instance
+const GITLAB_URL = (Bun.env.GITLAB_URL || "https://gitlab.com").replace(
+  /\/+$/,
+  ""
+);
+
+// API path of a project, which GitLab addresses by its URL-encoded full path
+export const projectPath = (owner: string, repo: string) =>
+  `/projects/${encodeURIComponent(`${owner}/${repo}`)}`;
+
+// URL of the next page from a Link header, or null on the last page
+export function nextPage(link: string | null): string | null {
+  return link?.match(/<([^>]+)>;\s*rel="next"/)?.[1] ?? null;
+}
+
+// GET an API path (or a full URL from a Link header) with the caller's
+// token, falling back to GITLAB_TOKEN. Network failures and 5xx responses
+// are retried like GitHub calls and share their timeout; any other
+// non-success response throws.
+export async function gitlabRequest(
+  path: string,
+  budget: RetryBudget,
+  token?: string
+): Promise<Response> {
+  const auth = token ?? Bun.env.GITLAB_TOKEN;
+  const headers: Record<string, string> = auth
+    ? { "PRIVATE-TOKEN": auth }
+    : {};
+  const url = path.startsWith("http") ? path : `${GITLAB_URL}/api/v4${path}`;
+
+  const response = await withRetry(
+    budget,
+    async () => {
+      const response = await trackUpstream("gitlab", () =>
+        fetch(url, { headers, signal: githubSignal(budget) })
+      );
+      if (response.status >= 500) throw new UpstreamError(response.status);
+      return response;
+    },
+    isTransient
+  );
+
+  if (response.status !== 200) {
+    throw upstreamError(response.status, (name) =>
+      response.headers.get(name)
+    );
+  }
+  return response;
+}
+
+// raw file URL on the GitLab instance, with each path segment encoded
+export function gitlabRawUrl(
+  owner: string,
+  repo: string,
+  branch: string,
+  path: string
+): string {
+  return `${GITLAB_URL}/${owner}/${repo}/-/raw/${encodePath(
+    branch
+  )}/${encodePath(path)}`;
+}
@@ -0,0 +1,78 @@
+// Minimal glob support for path filters:
+//   *      any run of characters within one path segment
+//   ?      a single character within one path segment
+//   [abc]  a character class ([!abc] negates)
+//   **     any number of whole path segments (including none)
+//   {a,b}  alternatives, expanded before matching (may be nested)
+// Patterns are matched against the full path, so "*.go" only matches
+// top-level files while "**/*.go" matches at any depth.
+
+// Expand the first top-level {a,b} group and recurse into the results
+export function expandBraces(pattern: string): string[] {
+  const open = pattern.indexOf("{");
+  if (open === -1) return [pattern];
+
+  let depth = 0;
+  let start = open + 1;
+  const alternatives: string[] = [];
+  for (let i = open; i < pattern.length; i++) {
+    const char = pattern[i];
+    if (char === "{") {
+      depth++;
+    } else if (char === "}") {
+      depth--;
+      if (depth === 0) {
+        alternatives.push(pattern.slice(start, i));
+        const before = pattern.slice(0, open);
+        const after = pattern.slice(i + 1);
+        return alternatives.flatMap((alt) =>
+          expandBraces(`${before}${alt}${after}`)
+        );
+      }
+    } else if (char === "," && depth === 1) {
+      alternatives.push(pattern.slice(start, i));
+      start = i + 1;
+    }
+  }
+
+  // Unbalanced brace, treat it literally
+  return [pattern];
+}
+
+export function globToRegExp(glob: string): RegExp {
+  let source = "";
+  for (let i = 0; i < glob.length; i++) {
+    const char = glob[i];
+    if (char === "*") {
+      if (glob[i + 1] === "*") {
+        i++;
+        if (glob[i + 1] === "/") {
+          // "**/" matches zero or more leading directories
+          i++;
+          source += "(?:.*/)?";
+        } else {
+          source += ".*";
+        }
+      } else {
+        source += "[^/]*";
+      }
+    } else if (char === "?") {
+      source += "[^/]";
+    } else if (char === "[" && glob.indexOf("]", i + 2) !== -1) {
+      const end = glob.indexOf("]", i + 2);
+      let cls = glob.slice(i + 1, end).replace(/\\/g, "\\\\");
+      if (cls[0] === "!") cls = `^${cls.slice(1)}`;
+      source += `[${cls}]`;
+      i = end;
+    } else {
+      source += char.replace(/[.+^${}()|[\]\\]/g, "\\$&");
+    }
+  }
+  return new RegExp(`^${source}$`);
+}
+
+// Compile patterns (brace-expanded) into a single path predicate
+export function compileGlobs(patterns: string[]): (path: string) => boolean {
+  const regexps = patterns.flatMap(expandBraces).map(globToRegExp);
+  return (path) => regexps.some((re) => re.test(path));
+}
@@ -0,0 +1,15 @@
+import { timingSafeEqual } from "node:crypto";
+
+// Admin endpoints require "Authorization: Bearer <ADMIN_TOKEN>" and are
+// disabled entirely when ADMIN_TOKEN is unset
+export function isAdmin(request: Request): boolean {
+  const token = Bun.env.ADMIN_TOKEN;
+  if (!token) return false;
+
+  const header = request.headers.get("authorization") || "";
+  const expected = Buffer.from(`Bearer ${token}`);
+  const actual = Buffer.from(header);
+  return (
+    actual.length === expected.length && timingSafeEqual(actual, expected)
+  );
+}
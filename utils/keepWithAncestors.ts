@@ -0,0 +1,24 @@
+import { TreeNode } from "./fetchRepoTree";
+
+// Keep the entries accepted by predicate plus all of their ancestor
+// directories, so matches are still rendered in context
+export function keepWithAncestors(
+  treeData: TreeNode[],
+  predicate: (item: TreeNode) => boolean
+): TreeNode[] {
+  const keep = new Set<string>();
+
+  treeData.forEach((item) => {
+    if (!predicate(item)) return;
+    keep.add(item.path);
+
+    let dir = item.path;
+    while (dir.includes("/")) {
+      dir = dir.slice(0, dir.lastIndexOf("/"));
+      if (keep.has(dir)) break;
+      keep.add(dir);
+    }
+  });
+
+  return treeData.filter((item) => keep.has(item.path));
+}
@@ -0,0 +1,113 @@
+// Prometheus metrics, kept in memory and rendered in the text exposition
+// format for GET /metrics:
+//   gtree_cache_lookups_total{kind,result}        branch/tree cache hits
+//                                                 and misses
+//   gtree_upstream_requests_total{provider,status} API calls by response
+//                                                 status ("error" when no
+//                                                 response came back)
+//   gtree_upstream_request_duration_seconds{provider} API call latency
+type Labels = Record<string, string>;
+
+const LATENCY_BUCKETS = [0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10];
+
+type Histogram = { buckets: number[]; sum: number; count: number };
+
+const cacheLookups = new Map<string, number>();
+const upstreamRequests = new Map<string, number>();
+const upstreamLatency = new Map<string, Histogram>();
+
+const escapeLabel = (value: string) =>
+  value.replace(/[\\"\n]/g, (char) => (char === "\n" ? "\\n" : `\\${char}`));
+
+const formatLabels = (labels: Labels) =>
+  Object.entries(labels)
+    .map(([name, value]) => `${name}="${escapeLabel(value)}"`)
+    .join(",");
+
+function increment(counter: Map<string, number>, labels: Labels) {
+  const key = formatLabels(labels);
+  counter.set(key, (counter.get(key) ?? 0) + 1);
+}
+
+export function recordCacheLookup(kind: "branch" | "tree", hit: boolean) {
+  increment(cacheLookups, { kind, result: hit ? "hit" : "miss" });
+}
+
+// Run one upstream API call, recording its status and latency. The status
+// is read from the response (or the error octokit throws for non-2xx).
+export async function trackUpstream<T>(
+  provider: string,
+  fn: () => Promise<T>
+): Promise<T> {
+  const start = performance.now();
+  let status = "error";
+  try {
+    const response: any = await fn();
+    status = String(response?.status ?? "error");
+    return response;
+  } catch (err: any) {
+    if (typeof err?.status === "number") status = String(err.status);
+    throw err;
+  } finally {
+    const seconds = (performance.now() - start) / 1000;
+    increment(upstreamRequests, { provider, status });
+
+    const key = formatLabels({ provider });
+    let histogram = upstreamLatency.get(key);
+    if (!histogram) {
+      histogram = { buckets: LATENCY_BUCKETS.map(() => 0), sum: 0, count: 0 };
+      upstreamLatency.set(key, histogram);
+    }
+    LATENCY_BUCKETS.forEach((le, index) => {
+      if (seconds <= le) histogram!.buckets[index]++;
+    });
+    histogram.sum += seconds;
+    histogram.count++;
+  }
+}
+
+function renderCounter(
+  name: string,
+  help: string,
+  counter: Map<string, number>
+): string[] {
+  const lines = [`# HELP ${name} ${help}`, `# TYPE ${name} counter`];
+  counter.forEach((value, labels) => {
+    lines.push(`${name}{${labels}} ${value}`);
+  });
+  return lines;
+}
+
+// All metrics in the Prometheus text format
+export function renderMetrics(): string {
+  const lines = [
+    ...renderCounter(
+      "gtree_cache_lookups_total",
+      "Default branch and tree cache lookups by result",
+      cacheLookups
+    ),
+    ...renderCounter(
+      "gtree_upstream_requests_total",
+      "Git provider API calls by response status",
+      upstreamRequests
+    ),
+  ];
+
+  const name = "gtree_upstream_request_duration_seconds";
+  lines.push(
+    `# HELP ${name} Latency of git provider API calls`,
+    `# TYPE ${name} histogram`
+  );
+  upstreamLatency.forEach((histogram, labels) => {
+    LATENCY_BUCKETS.forEach((le, index) => {
+      lines.push(
+        `${name}_bucket{${labels},le="${le}"} ${histogram.buckets[index]}`
+      );
+    });
+    lines.push(`${name}_bucket{${labels},le="+Inf"} ${histogram.count}`);
+    lines.push(`${name}_sum{${labels}} ${histogram.sum}`);
+    lines.push(`${name}_count{${labels}} ${histogram.count}`);
+  });
+
+  return `${lines.join("\n")}\n`;
+}
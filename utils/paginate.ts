@@ -0,0 +1,37 @@
+import { buildNestedTree, NestedNode } from "./buildNestedTree";
+import { TreeNode } from "./fetchRepoTree";
+import { SortOrder } from "./parseOptions";
+
+// Entries of treeData in the order the tree shows them: each directory
+// followed by everything below it, sorted the same way at every level
+function renderOrder(treeData: TreeNode[], order: SortOrder): TreeNode[] {
+  const byPath = new Map(treeData.map((item) => [item.path, item]));
+  const ordered: TreeNode[] = [];
+  const visit = (nodes: NestedNode[]) =>
+    nodes.forEach((node) => {
+      const item = byPath.get(node.path);
+      if (item) ordered.push(item);
+      if (node.children) visit(node.children);
+    });
+  visit(buildNestedTree(treeData, order));
+  return ordered;
+}
+
+// The limit entries (all when 0) starting at offset, counted in render
+// order so consecutive pages pick up where the last one stopped. Parent
+// directories of a page's entries are still shown, they just aren't
+// counted again. nextOffset is null on the last page.
+export function paginate(
+  treeData: TreeNode[],
+  offset: number,
+  limit: number,
+  order: SortOrder
+): { page: TreeNode[]; total: number; nextOffset: number | null } {
+  const ordered = renderOrder(treeData, order);
+  const end = limit ? offset + limit : ordered.length;
+  return {
+    page: ordered.slice(offset, end),
+    total: ordered.length,
+    nextOffset: end < ordered.length ? end : null,
+  };
+}
@@ -0,0 +1,36 @@
+const UNITS: Record<string, number> = {
+  ms: 1,
+  s: 1000,
+  m: 60 * 1000,
+  h: 60 * 60 * 1000,
+  d: 24 * 60 * 60 * 1000,
+};
+
+const NUMBER = /^\d+(?:\.\d+)?$/;
+// One or more number+unit parts, as in Go durations ("1h30m", "2m30s")
+const DURATION = /^(?:\d+(?:\.\d+)?\s*(?:ms|s|m|h|d)\s*)+$/;
+const PART = /(\d+(?:\.\d+)?)\s*(ms|s|m|h|d)/g;
+
+// Parse a duration like "90s", "15m", "6h", "1d" or "1h30m" into
+// milliseconds. A bare number is taken in bareUnit (seconds unless the
+// caller says otherwise). Returns null when the value isn't a duration.
+export function parseDuration(
+  value: string | number,
+  bareUnit: keyof typeof UNITS = "s"
+): number | null {
+  if (typeof value === "number") {
+    return Number.isFinite(value) && value >= 0
+      ? Math.round(value * UNITS[bareUnit])
+      : null;
+  }
+  const trimmed = value.trim();
+  if (NUMBER.test(trimmed)) {
+    return Math.round(Number(trimmed) * UNITS[bareUnit]);
+  }
+  if (!DURATION.test(trimmed)) return null;
+  let total = 0;
+  for (const [, amount, unit] of trimmed.matchAll(PART)) {
+    total += Number(amount) * UNITS[unit];
+  }
+  return Math.round(total);
+}
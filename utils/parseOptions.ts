@@ -0,0 +1,234 @@
+import { hasDotSegment } from "./encodePath";
+import { HttpError } from "./errors";
+
+export type Charset = "utf-8" | "ascii";
+export type IndentStyle = "unicode" | "ascii" | "spaces";
+export type SourceRoot = "none" | "auto";
+export type Format =
+  | "plain"
+  | "json"
+  | "files"
+  | "manifest"
+  | "csv"
+  | "markdown";
+export type EntryType = "all" | "dir" | "file";
+export type SortOrder = "dirs-first" | "name" | "name-desc" | "none";
+
+// Every query parameter the service understands
+const KNOWN_PARAMS = [
+  "format",
+  "charset",
+  "indent",
+  "indentSize",
+  "sourceRoot",
+  "include",
+  "exclude",
+  "activity",
+  "rawUrls",
+  "minSize",
+  "base",
+  "head",
+  "maxChildren",
+  "finalNewline",
+  "depth",
+  "path",
+  "nocache",
+  "sort",
+  "type",
+  "collapsible",
+  "icons",
+  "sizes",
+  "ignorefile",
+  "offset",
+  "limit",
+  // Read by the handler (see requestToken), never echoed back in options
+  "token",
+];
+
+// Operators can narrow the honoured parameters with a comma-separated
+// ALLOWED_QUERY_PARAMS. Anything else is ignored in the default "lenient"
+// QUERY_PARAMS_MODE, or rejected with a 400 in "strict" mode so typos like
+// ?dept=2 don't silently fall back to defaults.
+const ALLOWED_PARAMS = new Set(
+  Bun.env.ALLOWED_QUERY_PARAMS
+    ? Bun.env.ALLOWED_QUERY_PARAMS.split(",").map((name) => name.trim())
+    : KNOWN_PARAMS
+);
+const STRICT_PARAMS = Bun.env.QUERY_PARAMS_MODE === "strict";
+
+export type Options = {
+  format: Format;
+  charset: Charset;
+  indent: IndentStyle;
+  indentSize: number;
+  sourceRoot: SourceRoot;
+  // Subdirectory to render as the root, "" for the whole repo
+  path: string;
+  include: string[];
+  exclude: string[];
+  activity: boolean;
+  rawUrls: boolean;
+  minSize: number;
+  maxChildren: number;
+  finalNewline: boolean;
+  // Deepest level shown (1 = top-level entries only), 0 for no limit
+  depth: number;
+  // Page of entries shown: skip offset, then show at most limit (0 = all)
+  offset: number;
+  limit: number;
+  // Bypass cached trees and refetch from GitHub
+  nocache: boolean;
+  sort: SortOrder;
+  type: EntryType;
+  // Wrap directories in <details> blocks in format=markdown
+  collapsible: boolean;
+  // Prefix tree entries with an emoji for their type
+  icons: boolean;
+  // Show file sizes and directory totals in the tree
+  sizes: boolean;
+  // Hide what the repo's .gtreeignore (or .gitignore) lists. Off by default
+  // for manifest and csv, which list every committed file.
+  ignoreFile: boolean;
+  // Show the files changed between two refs instead of a single tree
+  compare: { base: string; head: string } | null;
+};
+
+function oneOf<T extends string>(
+  query: URLSearchParams,
+  name: string,
+  allowed: readonly T[],
+  fallback: T
+): T {
+  const value = query.get(name);
+  if (value === null || value === "") return fallback;
+  if (!allowed.includes(value as T)) {
+    throw new HttpError(
+      400,
+      `invalid ${name} "${value}", expected one of: ${allowed.join(", ")}`,
+      "invalid_option"
+    );
+  }
+  return value as T;
+}
+
+function flag(
+  query: URLSearchParams,
+  name: string,
+  fallback: boolean = false
+): boolean {
+  const value = oneOf(
+    query,
+    name,
+    ["true", "false", "1", "0"],
+    fallback ? "true" : "false"
+  );
+  return value === "true" || value === "1";
+}
+
+function integer(
+  query: URLSearchParams,
+  name: string,
+  fallback: number,
+  min: number,
+  max: number = Number.MAX_SAFE_INTEGER
+): number {
+  const value = query.get(name);
+  if (value === null || value === "") return fallback;
+  const parsed = Number(value);
+  if (!/^\d+$/.test(value) || parsed < min || parsed > max) {
+    const range =
+      max === Number.MAX_SAFE_INTEGER
+        ? `>= ${min}`
+        : `between ${min} and ${max}`;
+    throw new HttpError(
+      400,
+      `invalid ${name} "${value}", expected an integer ${range}`,
+      "invalid_option"
+    );
+  }
+  return parsed;
+}
+
+// Drop (or in strict mode reject) parameters that aren't allowed
+function allowedParams(query: URLSearchParams): URLSearchParams {
+  const allowed = new URLSearchParams();
+  query.forEach((value, name) => {
+    if (ALLOWED_PARAMS.has(name) && KNOWN_PARAMS.includes(name)) {
+      allowed.append(name, value);
+    } else if (STRICT_PARAMS) {
+      throw new HttpError(
+        400,
+        `unknown query parameter "${name}"`,
+        "unknown_parameter"
+      );
+    }
+  });
+  return allowed;
+}
+
+function comparison(query: URLSearchParams): Options["compare"] {
+  const base = query.get("base");
+  const head = query.get("head");
+  if (!base && !head) return null;
+  if (!base || !head) {
+    throw new HttpError(
+      400,
+      "base and head must be given together",
+      "invalid_option"
+    );
+  }
+  if (hasDotSegment(base) || hasDotSegment(head)) {
+    throw new HttpError(400, "invalid base or head ref", "invalid_option");
+  }
+  return { base, head };
+}
+
+// Formats that list the full tree state, so the ignore file is opt-in
+const COMPLETE_FORMATS: Format[] = ["manifest", "csv"];
+
+// Parse the rendering options from the request query string
+export function parseOptions(rawQuery: URLSearchParams): Options {
+  const query = allowedParams(rawQuery);
+  const format = oneOf(
+    query,
+    "format",
+    ["plain", "json", "files", "manifest", "csv", "markdown"],
+    "plain"
+  );
+  return {
+    format,
+    charset: oneOf(query, "charset", ["utf-8", "ascii"], "utf-8"),
+    indent: oneOf(query, "indent", ["unicode", "ascii", "spaces"], "unicode"),
+    indentSize: integer(query, "indentSize", 4, 1, 8),
+    sourceRoot: oneOf(query, "sourceRoot", ["none", "auto"], "none"),
+    path: (query.get("path") ?? "").replace(/^\/+|\/+$/g, ""),
+    include: query.getAll("include").filter(Boolean),
+    // Also accepts comma-separated lists (commas inside {a,b} don't split)
+    exclude: query
+      .getAll("exclude")
+      .flatMap((value) => value.split(/,(?![^{]*\})/))
+      .map((pattern) => pattern.trim())
+      .filter(Boolean),
+    activity: flag(query, "activity"),
+    rawUrls: flag(query, "rawUrls"),
+    minSize: integer(query, "minSize", 0, 0),
+    maxChildren: integer(query, "maxChildren", 0, 0),
+    finalNewline: flag(query, "finalNewline", true),
+    depth: integer(query, "depth", 0, 1),
+    offset: integer(query, "offset", 0, 0),
+    limit: integer(query, "limit", 0, 0),
+    nocache: flag(query, "nocache"),
+    sort: oneOf(
+      query,
+      "sort",
+      ["dirs-first", "name", "name-desc", "none"],
+      "dirs-first"
+    ),
+    type: oneOf(query, "type", ["all", "dir", "file"], "all"),
+    collapsible: flag(query, "collapsible"),
+    icons: flag(query, "icons"),
+    sizes: flag(query, "sizes"),
+    ignoreFile: flag(query, "ignorefile", !COMPLETE_FORMATS.includes(format)),
+    compare: comparison(query),
+  };
+}
@@ -0,0 +1,55 @@
+import { HttpError } from "./errors";
+import { normalizeRepoName, RepoPath } from "./parseRepoPath";
+import { DEFAULT_PROVIDER, providers } from "./providers";
+import { validateRepoName } from "./validateRepoName";
+
+const MAX_REPOS = 100;
+
+// Validate a JSON body listing repos as [{ owner, repo, branch?, provider? }]
+export function parseRepoList(body: unknown): RepoPath[] {
+  if (!Array.isArray(body) || body.length === 0) {
+    throw new HttpError(
+      400,
+      "expected a non-empty JSON array of { owner, repo, branch? }",
+      "invalid_body"
+    );
+  }
+  if (body.length > MAX_REPOS) {
+    throw new HttpError(
+      400,
+      `at most ${MAX_REPOS} repos per request`,
+      "invalid_body"
+    );
+  }
+
+  return body.map((item, index) => {
+    const { owner, repo, branch, provider = DEFAULT_PROVIDER } = item ?? {};
+    if (typeof owner !== "string" || typeof repo !== "string") {
+      throw new HttpError(
+        400,
+        `entry ${index}: owner and repo are required`,
+        "invalid_body"
+      );
+    }
+    if (branch !== undefined && typeof branch !== "string") {
+      throw new HttpError(
+        400,
+        `entry ${index}: branch must be a string`,
+        "invalid_body"
+      );
+    }
+    if (!(provider in providers)) {
+      throw new HttpError(
+        400,
+        `entry ${index}: unknown provider "${provider}"`,
+        "invalid_body"
+      );
+    }
+    const name = normalizeRepoName(repo);
+    const nameError = validateRepoName(provider, owner, name);
+    if (nameError) {
+      throw new HttpError(400, `entry ${index}: ${nameError}`, "invalid_body");
+    }
+    return { provider, owner, repo: name, branch: branch || undefined };
+  });
+}
@@ -0,0 +1,62 @@
+import { afterAll, beforeAll, describe, expect, test } from "bun:test";
+import { getTree } from "./getTree";
+import { parseRepoPath } from "./parseRepoPath";
+import { providers } from "./providers";
+import { createRetryBudget } from "./retryBudget";
+
+describe("parseRepoPath", () => {
+  test("drops a .git suffix and stray slashes from the repo", () => {
+    const clean = parseRepoPath("owner/repo");
+    expect(clean).toEqual({ provider: "github", owner: "owner", repo: "repo" });
+    expect(parseRepoPath("owner/repo.git")).toEqual(clean);
+    expect(parseRepoPath("owner/repo/")).toEqual(clean);
+    expect(parseRepoPath("/owner/repo.git/")).toEqual(clean);
+  });
+
+  test("keeps .git anywhere but at the end of the repo", () => {
+    expect(parseRepoPath("owner/repo.github.io")?.repo).toBe("repo.github.io");
+    expect(parseRepoPath("owner/repo.git/main")?.branch).toBe("main");
+    expect(parseRepoPath("owner/.git")?.repo).toBe(".git");
+  });
+
+  test("rejects branches with . or .. segments", () => {
+    expect(parseRepoPath("owner/repo/%2E%2E/x")).toBeNull();
+    expect(parseRepoPath("owner/repo/feature/./x")).toBeNull();
+  });
+});
+
+describe("repo.git, repo/ and repo", () => {
+  const github = providers.github;
+  const fetched: string[] = [];
+
+  beforeAll(() => {
+    providers.github = {
+      ...github,
+      fetchDefaultBranch: async (owner, repo) => ({
+        branch: "main",
+        fullName: `${owner}/${repo}`,
+      }),
+      fetchRepoTree: async (owner, repo, branch) => {
+        fetched.push(`${owner}/${repo}/${branch}`);
+        return { sha: "abc123", tree: [], truncated: false, redirected: false };
+      },
+    };
+  });
+
+  afterAll(() => {
+    providers.github = github;
+  });
+
+  test("share one GitHub request and cache key", async () => {
+    const results = [];
+    for (const path of ["dotgit/repo.git", "dotgit/repo/", "dotgit/repo"]) {
+      results.push(await getTree(parseRepoPath(path)!, createRetryBudget()));
+    }
+    expect(fetched).toEqual(["dotgit/repo/main"]);
+    expect(results.map((result) => result.cacheHit)).toEqual([
+      false,
+      true,
+      true,
+    ]);
+  });
+});
@@ -0,0 +1,44 @@
+import { hasDotSegment } from "./encodePath";
+import { DEFAULT_PROVIDER, providers } from "./providers";
+
+// Provider prefixes (/github/owner/repo) can be turned off with
+// PROVIDER_ROUTING=false, making every path a plain GitHub /owner/repo
+const PROVIDER_ROUTING = Bun.env.PROVIDER_ROUTING !== "false";
+
+export type RepoPath = {
+  provider: string;
+  owner: string;
+  repo: string;
+  branch?: string;
+};
+
+// Repo name without the .git suffix of clone URLs (owner/repo.git)
+export function normalizeRepoName(repo: string): string {
+  return repo.replace(/(.)\.git$/, "$1");
+}
+
+// Split "[provider/]owner/repo[/branch]" into its parts, or null when the
+// path doesn't have that shape. Everything after the repo is the branch, so
+// names with slashes like feature/login work. The first segment is only
+// taken as a provider when it names a known one and owner and repo follow
+// it, so /github/docs is still the github/docs repository. Stray slashes
+// and a .git suffix on the repo are dropped.
+export function parseRepoPath(path: string): RepoPath | null {
+  let parts: string[];
+  try {
+    parts = path.split("/").filter(Boolean).map(decodeURIComponent);
+  } catch {
+    return null;
+  }
+
+  let provider = DEFAULT_PROVIDER;
+  if (PROVIDER_ROUTING && parts.length >= 3 && parts[0] in providers) {
+    provider = parts.shift()!;
+  }
+
+  if (parts.length < 2) return null;
+  const [owner, repo, ...branchParts] = parts;
+  const branch = branchParts.length ? branchParts.join("/") : undefined;
+  if (branch && hasDotSegment(branch)) return null;
+  return { provider, owner, repo: normalizeRepoName(repo), branch };
+}
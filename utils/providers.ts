@@ -0,0 +1,30 @@
+import { fetchBlob } from "./fetchBlob";
+import { fetchDefaultBranch } from "./fetchDefaultBranch";
+import { fetchRepoTree } from "./fetchRepoTree";
+import { fetchGitlabBlob } from "./fetchGitlabBlob";
+import { fetchGitlabDefaultBranch } from "./fetchGitlabDefaultBranch";
+import { fetchGitlabTree } from "./fetchGitlabTree";
+import { gitlabRawUrl } from "./gitlab";
+import { rawUrl } from "./rawUrl";
+
+// A git hosting service the tree can be fetched from. Each knows its own API
+// URLs and auth header; callers only go through these functions.
+export type Provider = {
+  fetchDefaultBranch: typeof fetchDefaultBranch;
+  fetchRepoTree: typeof fetchRepoTree;
+  fetchBlob: typeof fetchBlob;
+  // URL serving a file's raw contents
+  rawUrl: typeof rawUrl;
+};
+
+export const DEFAULT_PROVIDER = "github";
+
+export const providers: Record<string, Provider> = {
+  github: { fetchDefaultBranch, fetchRepoTree, fetchBlob, rawUrl },
+  gitlab: {
+    fetchDefaultBranch: fetchGitlabDefaultBranch,
+    fetchRepoTree: fetchGitlabTree,
+    fetchBlob: fetchGitlabBlob,
+    rawUrl: gitlabRawUrl,
+  },
+};
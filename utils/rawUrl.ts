@@ -0,0 +1,13 @@
+import { encodePath } from "./encodePath";
+
+// raw.githubusercontent.com URL of a file, with each path segment encoded
+export function rawUrl(
+  owner: string,
+  repo: string,
+  branch: string,
+  path: string
+): string {
+  return `https://raw.githubusercontent.com/${owner}/${repo}/${encodePath(
+    branch
+  )}/${encodePath(path)}`;
+}
@@ -0,0 +1,57 @@
+import { buildTree } from "./buildTree";
+import { Comparison } from "./fetchComparison";
+import { compileGlobs } from "./glob";
+import { Options } from "./parseOptions";
+import { toAscii } from "./toAscii";
+
+// Render the files changed between two refs: a tree annotated with each
+// file's status, "<status>\t<path>" lines for format=files, or JSON
+export function renderComparison(
+  comparison: Comparison,
+  owner: string,
+  repo: string,
+  options: Options
+) {
+  const { base, head } = options.compare!;
+  const matches = compileGlobs(options.include);
+  const files = comparison.files
+    .filter((file) => !options.include.length || matches(file.path))
+    .sort((a, b) => (a.path < b.path ? -1 : a.path > b.path ? 1 : 0));
+
+  if (options.format === "json") {
+    return {
+      repo: `${owner}/${repo}`,
+      base,
+      head,
+      baseSha: comparison.baseSha,
+      headSha: comparison.headSha,
+      count: files.length,
+      files,
+    };
+  }
+
+  if (options.format === "files") {
+    return files
+      .map((file) => {
+        const path =
+          options.charset === "ascii" ? toAscii(file.path) : file.path;
+        return `${file.status}\t${path}`;
+      })
+      .join("\n");
+  }
+
+  const annotations = new Map<string, string>();
+  files.forEach((file) => {
+    annotations.set(
+      file.path,
+      file.previousPath
+        ? `[${file.status} from ${file.previousPath}]`
+        : `[${file.status}]`
+    );
+  });
+  return buildTree(
+    files.map((file) => ({ path: file.path, type: "blob", sha: "" })),
+    { owner, repo, branch: `${base}...${head}`, base: "", annotations },
+    options
+  );
+}
@@ -0,0 +1,20 @@
+// Requests served per repo since startup, for GET /stats. Repos beyond
+// MAX_TRACKED_REPOS distinct ones aren't counted, bounding memory.
+const MAX_TRACKED_REPOS = 10_000;
+
+const requests = new Map<string, number>();
+
+// Count a request for repo ("[provider/]owner/repo")
+export function recordRepoRequest(repo: string) {
+  const count = requests.get(repo);
+  if (count === undefined && requests.size >= MAX_TRACKED_REPOS) return;
+  requests.set(repo, (count ?? 0) + 1);
+}
+
+// The limit most requested repos, most requested first
+export function topRepos(limit: number) {
+  return [...requests]
+    .sort((a, b) => b[1] - a[1])
+    .slice(0, limit)
+    .map(([repo, count]) => ({ repo, requests: count }));
+}
@@ -0,0 +1,126 @@
+import { envNumber } from "./envNumber";
+import {
+  HttpError,
+  RetriedError,
+  UnreachableError,
+  UpstreamError,
+} from "./errors";
+
+// Per-request retry budget shared by every retrying operation, so retries in
+// separate steps (default branch lookup, tree fetch, ...) can't compound
+// past the request deadline.
+// Config: RETRY_BUDGET_ATTEMPTS (total retries per request, default 5)
+//         RETRY_BUDGET_MS (total time retries may start within, default 10s)
+//         GITHUB_MAX_RETRIES (retries of a single call, default 3)
+//         REQUEST_TIMEOUT_SECONDS (overall deadline of the request, after
+//           which in-flight calls are aborted, default 30)
+const BUDGET_ATTEMPTS = envNumber("RETRY_BUDGET_ATTEMPTS", 5, {
+  integer: true,
+});
+const BUDGET_MS = envNumber("RETRY_BUDGET_MS", 10_000);
+const MAX_RETRIES = envNumber("GITHUB_MAX_RETRIES", 3, { integer: true });
+const REQUEST_TIMEOUT_SECONDS = envNumber("REQUEST_TIMEOUT_SECONDS", 30, {
+  positive: true,
+});
+// Delay before the first retry, doubled for every one after it
+const BACKOFF_MS = 250;
+
+export type RetryBudget = {
+  attempts: number;
+  deadline: number;
+  // Aborted when the client goes away or the request times out, which
+  // aborts in-flight calls and stops any further retries
+  signal?: AbortSignal;
+};
+
+export function createRetryBudget(signal?: AbortSignal): RetryBudget {
+  const timeout = AbortSignal.timeout(REQUEST_TIMEOUT_SECONDS * 1000);
+  return {
+    attempts: BUDGET_ATTEMPTS,
+    deadline: Date.now() + BUDGET_MS,
+    signal: signal ? AbortSignal.any([signal, timeout]) : timeout,
+  };
+}
+
+// The 504 to respond with once the budget's request has run past
+// REQUEST_TIMEOUT_SECONDS (as opposed to a single call timing out, or the
+// client disconnecting), or null while it hasn't. Whatever error the
+// deadline surfaced as (an aborted fetch or body read, a skipped lookup),
+// this is the one to report.
+export function deadlineError(budget: RetryBudget): HttpError | null {
+  if (budget.signal?.reason?.name !== "TimeoutError") return null;
+  return new HttpError(
+    504,
+    `request took longer than ${REQUEST_TIMEOUT_SECONDS}s`,
+    "request_timeout"
+  );
+}
+
+// For best-effort lookups that swallow their errors: rethrow the deadline
+export function throwIfTimedOut(budget: RetryBudget) {
+  const err = deadlineError(budget);
+  if (err) throw err;
+}
+
+// Consume one retry (starting after delayMs). Returns false once the budget
+// is exhausted, in which case the caller should fail fast.
+export function takeRetry(budget: RetryBudget, delayMs: number = 0): boolean {
+  if (budget.attempts <= 0) return false;
+  if (Date.now() + delayMs > budget.deadline) return false;
+  budget.attempts -= 1;
+  return true;
+}
+
+// Whether an upstream call's error came with a response (a non-2xx status),
+// rather than the call failing before one arrived
+const responded = (err: any): boolean =>
+  err instanceof UpstreamError || Boolean(err?.response);
+
+// Connection failures and 5xx responses are worth retrying, 4xx never are
+export function isTransient(err: any): boolean {
+  return !responded(err) || err.status >= 500;
+}
+
+// Resolves after ms, or as soon as signal aborts
+function sleep(ms: number, signal?: AbortSignal): Promise<void> {
+  return new Promise((resolve) => {
+    const timer = setTimeout(resolve, ms);
+    signal?.addEventListener(
+      "abort",
+      () => {
+        clearTimeout(timer);
+        resolve();
+      },
+      { once: true }
+    );
+  });
+}
+
+// Run fn, retrying failures accepted by isRetryable with exponential backoff
+// while the budget allows. The error thrown in the end says how many
+// attempts were made, and failures without a response are thrown as an
+// UnreachableError.
+export async function withRetry<T>(
+  budget: RetryBudget,
+  fn: () => Promise<T>,
+  isRetryable: (err: any) => boolean
+): Promise<T> {
+  for (let attempt = 1; ; attempt++) {
+    try {
+      return await fn();
+    } catch (err) {
+      const delayMs = BACKOFF_MS * 2 ** (attempt - 1);
+      const retry =
+        attempt <= MAX_RETRIES &&
+        !budget.signal?.aborted &&
+        isRetryable(err) &&
+        takeRetry(budget, delayMs);
+      if (retry) await sleep(delayMs, budget.signal);
+      throwIfTimedOut(budget);
+      if (!retry || budget.signal?.aborted) {
+        const failure = responded(err) ? err : new UnreachableError(err);
+        throw attempt > 1 ? new RetriedError(failure, attempt) : failure;
+      }
+    }
+  }
+}
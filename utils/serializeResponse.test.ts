@@ -0,0 +1,58 @@
+import { describe, expect, test } from "bun:test";
+import { Elysia } from "elysia";
+import { serializeResponse } from "./serializeResponse";
+import { GZIP_MIN_BYTES } from "./worthGzipping";
+
+const small = "a".repeat(GZIP_MIN_BYTES - 1);
+const threshold = "a".repeat(GZIP_MIN_BYTES);
+
+const app = new Elysia()
+  .use(serializeResponse)
+  .get("/small", () => small)
+  .get("/threshold", () => threshold)
+  .head("/threshold", () => threshold)
+  .get("/json", () => ({ tree: threshold }));
+
+const get = (path: string, acceptEncoding = "gzip") =>
+  app.handle(
+    new Request(`http://localhost${path}`, {
+      headers: { "Accept-Encoding": acceptEncoding },
+    })
+  );
+
+describe("serializeResponse", () => {
+  test("sends bodies below GZIP_MIN_BYTES uncompressed", async () => {
+    const response = await get("/small");
+    expect(response.headers.get("content-encoding")).toBeNull();
+    expect(response.headers.get("vary")).toBe("Accept-Encoding");
+    expect(await response.text()).toBe(small);
+  });
+
+  test("gzips bodies of exactly GZIP_MIN_BYTES", async () => {
+    const response = await get("/threshold");
+    expect(response.headers.get("content-encoding")).toBe("gzip");
+    const body = Bun.gunzipSync(new Uint8Array(await response.arrayBuffer()));
+    expect(new TextDecoder().decode(body)).toBe(threshold);
+  });
+
+  test("gzips JSON bodies too", async () => {
+    const response = await get("/json");
+    expect(response.headers.get("content-encoding")).toBe("gzip");
+    expect(response.headers.get("content-type")).toContain("application/json");
+  });
+
+  test("never gzips for clients that don't accept it", async () => {
+    const response = await get("/threshold", "identity");
+    expect(response.headers.get("content-encoding")).toBeNull();
+    expect(await response.text()).toBe(threshold);
+  });
+
+  test("answers HEAD with the length of the uncompressed body", async () => {
+    const response = await app.handle(
+      new Request("http://localhost/threshold", { method: "HEAD" })
+    );
+    expect(response.headers.get("content-length")).toBe(
+      String(GZIP_MIN_BYTES)
+    );
+  });
+});
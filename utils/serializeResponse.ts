@@ -0,0 +1,40 @@
+import { Elysia } from "elysia";
+import { acceptsGzip } from "./acceptsGzip";
+import { worthGzipping } from "./worthGzipping";
+
+// Serialize text/JSON bodies ourselves so HEAD can report their length and
+// bodies of at least GZIP_MIN_BYTES can be gzipped for clients that accept
+// it. Applies to every route of the app using it.
+export const serializeResponse = new Elysia({
+  name: "serializeResponse",
+}).mapResponse({ as: "global" }, ({ request, response, set }) => {
+  if (typeof response !== "string" && typeof response !== "object") return;
+  if (response === null || response instanceof Response) return;
+
+  const isJson = typeof response === "object";
+  const body = new TextEncoder().encode(
+    isJson ? JSON.stringify(response) : (response as string)
+  );
+  set.headers["Content-Type"] ??= isJson
+    ? "application/json; charset=utf-8"
+    : "text/plain; charset=utf-8";
+  const init = {
+    status: set.status as number,
+    headers: set.headers as Record<string, string>,
+  };
+
+  // HEAD gets exactly the headers a GET would, without compressing or
+  // sending the body
+  if (request.method === "HEAD") {
+    set.headers["Content-Length"] = `${body.byteLength}`;
+    return new Response(null, init);
+  }
+
+  if (!acceptsGzip(request.headers.get("accept-encoding"))) return;
+  const vary = set.headers["Vary"];
+  set.headers["Vary"] = vary ? `${vary}, Accept-Encoding` : "Accept-Encoding";
+  if (!worthGzipping(body.byteLength)) return;
+
+  set.headers["Content-Encoding"] = "gzip";
+  return new Response(Bun.gzipSync(body), init);
+});
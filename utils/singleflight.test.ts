@@ -0,0 +1,72 @@
+import { describe, expect, test } from "bun:test";
+import { singleflight } from "./singleflight";
+
+// Resolves with value after ms, or rejects as soon as signal aborts
+function slow<T>(value: T, ms: number, signal: AbortSignal): Promise<T> {
+  return new Promise((resolve, reject) => {
+    const timer = setTimeout(() => resolve(value), ms);
+    signal.addEventListener("abort", () => {
+      clearTimeout(timer);
+      reject(signal.reason);
+    });
+  });
+}
+
+describe("singleflight", () => {
+  test("runs one call for concurrent callers", async () => {
+    let calls = 0;
+    const fn = (signal: AbortSignal) => {
+      calls += 1;
+      return slow("tree", 20, signal);
+    };
+    const results = await Promise.all([
+      singleflight("shared", fn),
+      singleflight("shared", fn),
+    ]);
+    expect(results).toEqual(["tree", "tree"]);
+    expect(calls).toBe(1);
+  });
+
+  test("keeps the call going while a caller still waits", async () => {
+    const first = new AbortController();
+    let shared: AbortSignal | undefined;
+    const fn = (signal: AbortSignal) => {
+      shared = signal;
+      return slow("tree", 50, signal);
+    };
+    const abandoned = singleflight("waiting", fn, first.signal);
+    const waiting = singleflight("waiting", fn, new AbortController().signal);
+    first.abort();
+    await expect(abandoned).rejects.toThrow();
+    expect(shared?.aborted).toBe(false);
+    expect(await waiting).toBe("tree");
+  });
+
+  test("aborts the call once every caller has gone away", async () => {
+    const first = new AbortController();
+    const second = new AbortController();
+    let shared: AbortSignal | undefined;
+    const fn = (signal: AbortSignal) => {
+      shared = signal;
+      return slow("tree", 5000, signal);
+    };
+    const results = [
+      singleflight("abandoned", fn, first.signal),
+      singleflight("abandoned", fn, second.signal),
+    ];
+    first.abort();
+    second.abort();
+    await expect(results[0]).rejects.toThrow();
+    await expect(results[1]).rejects.toThrow();
+    expect(shared?.aborted).toBe(true);
+
+    // A later caller starts over instead of joining the aborted call
+    let calls = 0;
+    const again = await singleflight("abandoned", async () => {
+      calls += 1;
+      return "fresh";
+    });
+    expect(again).toBe("fresh");
+    expect(calls).toBe(1);
+  });
+});
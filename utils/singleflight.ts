@@ -0,0 +1,67 @@
+type Flight = {
+  promise: Promise<unknown>;
+  // Callers still waiting for the result
+  waiters: number;
+  controller: AbortController;
+};
+
+const inflight = new Map<string, Flight>();
+
+// Settle with promise, or reject with signal's reason (calling onAbort) as
+// soon as it aborts
+function untilAborted<T>(
+  promise: Promise<T>,
+  signal: AbortSignal,
+  onAbort: () => void
+): Promise<T> {
+  if (signal.aborted) {
+    onAbort();
+    return Promise.reject(signal.reason);
+  }
+  return new Promise<T>((resolve, reject) => {
+    const abort = () => {
+      onAbort();
+      reject(signal.reason);
+    };
+    signal.addEventListener("abort", abort, { once: true });
+    promise
+      .then(resolve, reject)
+      .finally(() => signal.removeEventListener("abort", abort));
+  });
+}
+
+// Start fn and register it as the call in flight for key
+function start<T>(key: string, fn: (signal: AbortSignal) => Promise<T>) {
+  const controller = new AbortController();
+  const promise = fn(controller.signal).finally(() => {
+    if (inflight.get(key) === flight) inflight.delete(key);
+  });
+  const flight: Flight = { promise, waiters: 0, controller };
+  inflight.set(key, flight);
+  return flight;
+}
+
+// Run fn once for concurrent callers with the same key: while a call is in
+// flight, later callers get its promise (and its result or error) instead
+// of starting their own. Keys are the cache keys being filled, so a popular
+// repo's expiry triggers one upstream fetch rather than one per request.
+// Each caller stops waiting when its own signal aborts, and once every
+// caller has, the signal passed to fn aborts too. Callers without a signal
+// wait until the call settles.
+export function singleflight<T>(
+  key: string,
+  fn: (signal: AbortSignal) => Promise<T>,
+  signal?: AbortSignal
+): Promise<T> {
+  const joined = inflight.get(key) ?? start(key, fn);
+  joined.waiters += 1;
+  const promise = joined.promise as Promise<T>;
+  if (!signal) return promise;
+  return untilAborted(promise, signal, () => {
+    joined.waiters -= 1;
+    if (joined.waiters > 0) return;
+    // Nobody is left to use the result. Later callers start a new call.
+    if (inflight.get(key) === joined) inflight.delete(key);
+    joined.controller.abort(signal.reason);
+  });
+}
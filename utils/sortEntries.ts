@@ -0,0 +1,30 @@
+import { SortOrder } from "./parseOptions";
+
+type Entry = { name: string; isDir: boolean };
+
+const byName = (a: Entry, b: Entry) =>
+  a.name.localeCompare(b.name, undefined, { sensitivity: "base" }) ||
+  (a.name < b.name ? -1 : a.name > b.name ? 1 : 0);
+
+// Order the entries of one directory:
+//   dirs-first  directories, then files, each by name (default)
+//   name        by name, case-insensitively
+//   name-desc   by name, reversed
+//   none        as listed by the API
+export function sortEntries<T extends Entry>(
+  entries: T[],
+  order: SortOrder
+): T[] {
+  switch (order) {
+    case "none":
+      return entries;
+    case "name":
+      return [...entries].sort(byName);
+    case "name-desc":
+      return [...entries].sort((a, b) => byName(b, a));
+    default:
+      return [...entries].sort(
+        (a, b) => Number(b.isDir) - Number(a.isDir) || byName(a, b)
+      );
+  }
+}
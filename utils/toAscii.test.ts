@@ -0,0 +1,49 @@
+import { describe, expect, test } from "bun:test";
+import { buildTree } from "./buildTree";
+import { parseOptions } from "./parseOptions";
+import { toAscii } from "./toAscii";
+
+const SEVEN_BIT = /^[\x00-\x7f]*$/;
+
+describe("toAscii", () => {
+  test("transliterates accented characters", () => {
+    expect(toAscii("café")).toBe("cafe");
+    expect(toAscii("naïve/résumé.md")).toBe("naive/resume.md");
+  });
+
+  test("escapes what can't be transliterated", () => {
+    expect(toAscii("日本.txt")).toBe("\\u65e5\\u672c.txt");
+    expect(toAscii("Ærø")).toBe("\\u00c6r\\u00f8");
+  });
+
+  test("leaves ASCII alone", () => {
+    expect(toAscii("src/index.ts")).toBe("src/index.ts");
+  });
+});
+
+describe("charset=ascii", () => {
+  const tree = [
+    { path: "café", type: "tree", sha: "1" },
+    { path: "café/naïve.md", type: "blob", sha: "2" },
+    { path: "日本.txt", type: "blob", sha: "3" },
+  ];
+  const context = { owner: "owner", repo: "repo", branch: "main", base: "" };
+
+  test("with indent=ascii gives fully 7-bit output", () => {
+    const options = parseOptions(
+      new URLSearchParams("charset=ascii&indent=ascii")
+    );
+    const output = buildTree(tree, context, options);
+    expect(output).toMatch(SEVEN_BIT);
+    expect(output).toContain("cafe/");
+    expect(output).toContain("naive.md");
+    expect(output).toContain("\\u65e5\\u672c.txt");
+  });
+
+  test("keeps UTF-8 names by default", () => {
+    const options = parseOptions(new URLSearchParams());
+    const output = buildTree(tree, context, options);
+    expect(output).toContain("café/");
+    expect(output).toContain("naïve.md");
+  });
+});
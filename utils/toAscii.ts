@@ -0,0 +1,10 @@
+// Transliterate accented characters to their base letter (é -> e) and
+// \u-escape anything that is still outside 7-bit ASCII.
+export function toAscii(value: string): string {
+  return value
+    .normalize("NFD")
+    .replace(/[\u0300-\u036f]/g, "")
+    .replace(/[^\x00-\x7f]/g, (char) => {
+      return `\\u${char.charCodeAt(0).toString(16).padStart(4, "0")}`;
+    });
+}
@@ -0,0 +1,40 @@
+import { describe, expect, test } from "bun:test";
+import { validateRepoName } from "./validateRepoName";
+
+describe("validateRepoName", () => {
+  test("accepts ordinary names", () => {
+    expect(validateRepoName("github", "henilmalaviya", "gtree")).toBeNull();
+    expect(validateRepoName("github", "some-org", "my_repo.js")).toBeNull();
+  });
+
+  test("accepts names starting with a dot", () => {
+    expect(validateRepoName("github", "org", ".github")).toBeNull();
+    expect(validateRepoName("github", "user", ".dotfiles")).toBeNull();
+  });
+
+  test("rejects the . and .. path segments", () => {
+    expect(validateRepoName("github", "org", ".")).not.toBeNull();
+    expect(validateRepoName("github", "org", "..")).not.toBeNull();
+    expect(validateRepoName("github", "..", "repo")).not.toBeNull();
+  });
+
+  test("rejects characters outside the allowed set", () => {
+    expect(validateRepoName("github", "org", "re po")).not.toBeNull();
+    expect(validateRepoName("github", "org", "repo?")).not.toBeNull();
+    expect(validateRepoName("github", "or g", "repo")).not.toBeNull();
+    expect(validateRepoName("github", "org", "-repo")).not.toBeNull();
+  });
+
+  test("says which part is invalid", () => {
+    expect(validateRepoName("github", "o/wner", "repo")).toContain("owner");
+    expect(validateRepoName("github", "owner", "re/po")).toContain("repo");
+  });
+
+  test("applies GitHub's length limits only to GitHub", () => {
+    const owner = "a".repeat(40);
+    const repo = "r".repeat(101);
+    expect(validateRepoName("github", owner, "repo")).toContain("at most 39");
+    expect(validateRepoName("github", "org", repo)).toContain("at most 100");
+    expect(validateRepoName("gitlab", owner, repo)).toBeNull();
+  });
+});
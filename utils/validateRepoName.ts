@@ -0,0 +1,37 @@
+import { DEFAULT_PROVIDER } from "./providers";
+
+// Letters, digits, "-", "_" and ".", not starting with "-". A leading "." is
+// fine (.github, .dotfiles), only the "." and ".." path segments are not.
+const NAME = /^[A-Za-z0-9_.][A-Za-z0-9._-]*$/;
+const RESERVED = [".", ".."];
+// GitHub caps owners at 39 characters and repos at 100; GitLab allows
+// longer names
+const MAX_OWNER = { github: 39, other: 255 };
+const MAX_REPO = { github: 100, other: 255 };
+
+// Why owner/repo can't be a valid repository on provider, or null when it
+// can. Checked before any cache or API access.
+export function validateRepoName(
+  provider: string,
+  owner: string,
+  repo: string
+): string | null {
+  const limits = provider === DEFAULT_PROVIDER ? "github" : "other";
+  const checks: [string, string, number][] = [
+    ["owner", owner, MAX_OWNER[limits]],
+    ["repo", repo, MAX_REPO[limits]],
+  ];
+
+  for (const [field, value, max] of checks) {
+    if (RESERVED.includes(value)) {
+      return `invalid ${field} "${value}"`;
+    }
+    if (!NAME.test(value)) {
+      return `invalid ${field} "${value}", only letters, digits, "-", "_" and "." are allowed`;
+    }
+    if (value.length > max) {
+      return `invalid ${field} "${value}", at most ${max} characters`;
+    }
+  }
+  return null;
+}
@@ -0,0 +1,58 @@
+import { randomUUID } from "node:crypto";
+import { getTree } from "./getTree";
+import { mapLimit } from "./mapLimit";
+import { RepoPath } from "./parseRepoPath";
+import { createRetryBudget } from "./retryBudget";
+
+// Background jobs that fetch and cache a list of repo trees, e.g. to keep
+// hot repos warm after a deploy. Finished jobs are kept around for
+// WARM_JOB_TTL_MS so their results can be polled.
+const WARM_CONCURRENCY = 4;
+const WARM_JOB_TTL_MS = 60 * 60 * 1000;
+
+type WarmResult = RepoPath & {
+  status: "pending" | "ok" | "error";
+  error?: string;
+};
+
+export type WarmJob = {
+  id: string;
+  status: "running" | "done";
+  startedAt: string;
+  finishedAt?: string;
+  results: WarmResult[];
+};
+
+const jobs = new Map<string, WarmJob>();
+
+export function getWarmJob(id: string): WarmJob | null {
+  return jobs.get(id) ?? null;
+}
+
+// Start warming targets in the background and return the job immediately
+export function startWarmJob(targets: RepoPath[]): WarmJob {
+  const job: WarmJob = {
+    id: randomUUID(),
+    status: "running",
+    startedAt: new Date().toISOString(),
+    results: targets.map((target) => ({ ...target, status: "pending" })),
+  };
+  jobs.set(job.id, job);
+
+  mapLimit(job.results, WARM_CONCURRENCY, async (result) => {
+    try {
+      const { branch } = await getTree(result, createRetryBudget());
+      result.branch = branch;
+      result.status = "ok";
+    } catch (err: any) {
+      result.status = "error";
+      result.error = err?.message || "unknown";
+    }
+  }).then(() => {
+    job.status = "done";
+    job.finishedAt = new Date().toISOString();
+    setTimeout(() => jobs.delete(job.id), WARM_JOB_TTL_MS);
+  });
+
+  return job;
+}
@@ -0,0 +1,9 @@
+import { Options } from "./parseOptions";
+
+// Line-based tools (wc -l, while read) expect text to end with a newline.
+// finalNewline=false keeps the old unterminated output.
+export function withFinalNewline<T>(body: T, options: Options): T {
+  if (typeof body !== "string" || !options.finalNewline) return body;
+  if (body === "" || body.endsWith("\n")) return body;
+  return `${body}\n` as T;
+}
@@ -0,0 +1,18 @@
+import { describe, expect, test } from "bun:test";
+import { worthGzipping } from "./worthGzipping";
+
+describe("worthGzipping", () => {
+  test("skips bodies just below the threshold", () => {
+    expect(worthGzipping(1023, 1024)).toBe(false);
+    expect(worthGzipping(0, 1024)).toBe(false);
+  });
+
+  test("compresses bodies at or above the threshold", () => {
+    expect(worthGzipping(1024, 1024)).toBe(true);
+    expect(worthGzipping(1025, 1024)).toBe(true);
+  });
+
+  test("compresses everything with a threshold of 0", () => {
+    expect(worthGzipping(0, 0)).toBe(true);
+  });
+});
@@ -0,0 +1,15 @@
+import { envNumber } from "./envNumber";
+
+// Responses smaller than this many bytes are sent uncompressed even when the
+// client accepts gzip, since compressing them costs more than it saves
+export const GZIP_MIN_BYTES = envNumber("GZIP_MIN_BYTES", 1024, {
+  integer: true,
+});
+
+// Whether a body of byteLength bytes is big enough to gzip
+export function worthGzipping(
+  byteLength: number,
+  minBytes: number = GZIP_MIN_BYTES
+): boolean {
+  return byteLength >= minBytes;
+}